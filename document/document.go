@@ -0,0 +1,316 @@
+// Package document reads chapter HTML into a small list of blocks (paragraphs,
+// headings, images, scene breaks) so output formats other than EPUB don't
+// each have to walk the HTML themselves.
+package document
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+type Kind int
+
+const (
+	Paragraph Kind = iota
+	Heading
+	// Quote is a paragraph inside a blockquote.
+	Quote
+	// Preformatted keeps its line breaks and spaces.
+	Preformatted
+	Image
+	// Rule is a scene break, an <hr> in the HTML.
+	Rule
+)
+
+// Align is the text-align of a block.
+type Align int
+
+const (
+	AlignLeft Align = iota
+	AlignCenter
+	AlignRight
+	AlignJustify
+)
+
+// Block is a paragraph-level piece of a chapter.
+type Block struct {
+	Kind Kind
+	// Level is 1 to 6 for headings.
+	Level int
+	// Align comes from text-align or the align attribute; Wattpad centers
+	// scene breaks and the odd paragraph.
+	Align Align
+	Runs  []Run
+	// Image is the file name under images/ for Image blocks, taken from a
+	// src like ../images/chapter1_img0.png, and Alt its alt text.
+	Image string
+	Alt   string
+}
+
+// Run is a piece of text with the same style. A "\n" inside Text is a line
+// break from a <br>.
+type Run struct {
+	Text   string
+	Bold   bool
+	Italic bool
+	// Link is the href of the link the text is in, if any.
+	Link string
+}
+
+// Text returns the text of the block without styles.
+func (b Block) Text() string {
+	var text strings.Builder
+	for _, run := range b.Runs {
+		text.WriteString(run.Text)
+	}
+	return text.String()
+}
+
+// Parse reads the body of a chapter. Text outside any block element becomes a
+// paragraph of its own, and images inside a paragraph split it.
+func Parse(body string) ([]Block, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(body), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{}
+	for _, node := range nodes {
+		p.walk(node, style{})
+	}
+	p.flush()
+	return p.blocks, nil
+}
+
+// style is what the inline elements around a text node set.
+type style struct {
+	bold   bool
+	italic bool
+	link   string
+}
+
+type parser struct {
+	blocks []Block
+	// current is the block text is being added to
+	current Block
+	open    bool
+	// kind and the rest are what the next block starts with
+	kind  Kind
+	level int
+	align Align
+}
+
+func (p *parser) walk(n *html.Node, st style) {
+	switch n.Type {
+	case html.TextNode:
+		p.text(n.Data, st)
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			p.walk(c, st)
+		}
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Title:
+		return
+
+	case atom.Br:
+		p.text("\n", st)
+		return
+
+	case atom.Hr:
+		p.flush()
+		p.blocks = append(p.blocks, Block{Kind: Rule})
+		return
+
+	case atom.Img:
+		p.image(n)
+		return
+
+	case atom.B, atom.Strong:
+		st.bold = true
+	case atom.I, atom.Em, atom.Cite:
+		st.italic = true
+	case atom.A:
+		st.link = attr(n, "href")
+	}
+
+	if kind, level, ok := blockKind(n); ok {
+		outerKind, outerLevel, outerAlign := p.kind, p.level, p.align
+		p.flush()
+		// a paragraph inside a blockquote is still part of the quote
+		if kind == Paragraph && outerKind == Quote {
+			kind = Quote
+		}
+		p.kind, p.level, p.align = kind, level, alignment(n, p.align)
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			p.walk(c, st)
+		}
+		p.flush()
+		p.kind, p.level, p.align = outerKind, outerLevel, outerAlign
+		return
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.walk(c, st)
+	}
+}
+
+// blockKind tells whether n starts a new block, and which.
+func blockKind(n *html.Node) (Kind, int, bool) {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level, _ := strconv.Atoi(n.Data[1:])
+		return Heading, level, true
+	case atom.Blockquote:
+		return Quote, 0, true
+	case atom.Pre:
+		return Preformatted, 0, true
+	case atom.P, atom.Div, atom.Li, atom.Section, atom.Article, atom.Header, atom.Footer,
+		atom.Figure, atom.Figcaption, atom.Ul, atom.Ol, atom.Table, atom.Tr, atom.Dd, atom.Dt:
+		return Paragraph, 0, true
+	}
+	return 0, 0, false
+}
+
+// text adds a text node to the current block, collapsing whitespace like a
+// browser would outside <pre>.
+func (p *parser) text(data string, st style) {
+	if p.kind != Preformatted && data != "\n" {
+		data = collapse(data)
+		// no space at the start of a block or right after a line break
+		if !p.open || endsWith(p.current, " ") || endsWith(p.current, "\n") {
+			data = strings.TrimLeft(data, " ")
+		}
+	}
+	if data == "" {
+		return
+	}
+
+	if !p.open {
+		p.current = Block{Kind: p.kind, Level: p.level, Align: p.align}
+		p.open = true
+	}
+
+	run := Run{Text: data, Bold: st.bold, Italic: st.italic, Link: st.link}
+	if last := len(p.current.Runs) - 1; last >= 0 && sameStyle(p.current.Runs[last], run) {
+		p.current.Runs[last].Text += data
+		return
+	}
+	p.current.Runs = append(p.current.Runs, run)
+}
+
+func (p *parser) image(n *html.Node) {
+	src := attr(n, "src")
+	if src == "" {
+		return
+	}
+
+	p.flush()
+	p.blocks = append(p.blocks, Block{Kind: Image, Image: path.Base(src), Alt: attr(n, "alt")})
+}
+
+// flush closes the current block, dropping it when it has no visible text.
+func (p *parser) flush() {
+	if !p.open {
+		return
+	}
+	p.open = false
+
+	block := p.current
+	if block.Kind != Preformatted {
+		trimRuns(&block)
+	}
+	if strings.TrimSpace(block.Text()) != "" {
+		p.blocks = append(p.blocks, block)
+	}
+}
+
+// trimRuns removes the spaces and line breaks at both ends of the block.
+func trimRuns(block *Block) {
+	for len(block.Runs) > 0 {
+		first := &block.Runs[0]
+		first.Text = strings.TrimLeft(first.Text, " \n")
+		if first.Text != "" {
+			break
+		}
+		block.Runs = block.Runs[1:]
+	}
+	for len(block.Runs) > 0 {
+		last := &block.Runs[len(block.Runs)-1]
+		last.Text = strings.TrimRight(last.Text, " \n")
+		if last.Text != "" {
+			break
+		}
+		block.Runs = block.Runs[:len(block.Runs)-1]
+	}
+}
+
+func collapse(s string) string {
+	var out strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			space = true
+			continue
+		}
+		if space {
+			out.WriteByte(' ')
+			space = false
+		}
+		out.WriteRune(r)
+	}
+	if space {
+		out.WriteByte(' ')
+	}
+	return out.String()
+}
+
+func endsWith(block Block, suffix string) bool {
+	if len(block.Runs) == 0 {
+		return false
+	}
+	return strings.HasSuffix(block.Runs[len(block.Runs)-1].Text, suffix)
+}
+
+func sameStyle(a Run, b Run) bool {
+	return a.Bold == b.Bold && a.Italic == b.Italic && a.Link == b.Link
+}
+
+// alignment is the text-align of n, or inherited when n doesn't set one.
+func alignment(n *html.Node, inherited Align) Align {
+	value := strings.ToLower(strings.TrimSpace(attr(n, "align")))
+	for _, decl := range strings.Split(attr(n, "style"), ";") {
+		if name, v, ok := strings.Cut(decl, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "text-align") {
+			value = strings.ToLower(strings.TrimSpace(v))
+		}
+	}
+
+	switch value {
+	case "center":
+		return AlignCenter
+	case "right", "end":
+		return AlignRight
+	case "justify":
+		return AlignJustify
+	case "left", "start":
+		return AlignLeft
+	}
+	return inherited
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
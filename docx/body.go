@@ -0,0 +1,379 @@
+package docx
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"path"
+	"strings"
+	"wattpad-to-ebook/document"
+	"wattpad-to-ebook/ebook"
+
+	"github.com/beevik/etree"
+)
+
+// The page is A4 with 1 inch margins, in twips (1/1440 of an inch), and the
+// room it leaves for images in EMUs (1/914400 of an inch).
+const (
+	pageWidth     = 11906
+	pageHeight    = 16838
+	pageMargin    = 1440
+	emuPerTwip    = 635
+	emuPerPixel   = 9525
+	textWidthEMU  = (pageWidth - 2*pageMargin) * emuPerTwip
+	textHeightEMU = (pageHeight - 2*pageMargin) * emuPerTwip
+)
+
+// media is an image stored in word/media.
+type media struct {
+	name      string
+	mediaType string
+	data      []byte
+	rel       string
+	width     int
+	height    int
+}
+
+// builder writes document.xml and collects the relationships and images it
+// refers to.
+type builder struct {
+	book   *ebook.Book
+	images map[string]ebook.Image
+	body   *etree.Element
+
+	rels      *etree.Document
+	relsRoot  *etree.Element
+	nextRel   int
+	links     map[string]string
+	media     []*media
+	mediaByID map[string]*media
+
+	// drawings and bookmarks count the ids each needs
+	drawings  int
+	bookmarks int
+}
+
+func newBuilder(book *ebook.Book) *builder {
+	b := &builder{
+		book:      book,
+		images:    map[string]ebook.Image{},
+		links:     map[string]string{},
+		mediaByID: map[string]*media{},
+		rels:      newXML(),
+	}
+	for _, img := range book.Images() {
+		b.images[img.Name] = img
+	}
+	b.relsRoot = b.rels.CreateElement("Relationships")
+	b.relsRoot.CreateAttr("xmlns", relsNamespace)
+	b.rel(relStyles, "styles.xml")
+	return b
+}
+
+// rel adds a relationship of document.xml and returns its id.
+func (b *builder) rel(kind string, target string) (string, *etree.Element) {
+	b.nextRel++
+	id := fmt.Sprintf("rId%d", b.nextRel)
+	return id, addRel(b.relsRoot, id, kind, target)
+}
+
+func (b *builder) document() (*etree.Document, error) {
+	doc := newXML()
+	root := doc.CreateElement("w:document")
+	root.CreateAttr("xmlns:w", wNamespace)
+	root.CreateAttr("xmlns:r", rNamespace)
+	root.CreateAttr("xmlns:wp", "http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing")
+	root.CreateAttr("xmlns:a", "http://schemas.openxmlformats.org/drawingml/2006/main")
+	root.CreateAttr("xmlns:pic", "http://schemas.openxmlformats.org/drawingml/2006/picture")
+	b.body = root.CreateElement("w:body")
+
+	b.titlePage()
+	for _, entry := range b.book.TOC() {
+		if err := b.entry(entry, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	sectPr := b.body.CreateElement("w:sectPr")
+	size := sectPr.CreateElement("w:pgSz")
+	size.CreateAttr("w:w", fmt.Sprint(pageWidth))
+	size.CreateAttr("w:h", fmt.Sprint(pageHeight))
+	margin := sectPr.CreateElement("w:pgMar")
+	for _, side := range []string{"w:top", "w:right", "w:bottom", "w:left"} {
+		margin.CreateAttr(side, fmt.Sprint(pageMargin))
+	}
+	for _, attr := range []string{"w:header", "w:footer"} {
+		margin.CreateAttr(attr, fmt.Sprint(pageMargin/2))
+	}
+	margin.CreateAttr("w:gutter", "0")
+	return doc, nil
+}
+
+// titlePage is the cover, the title and author and the details of the
+// story, on a page of their own.
+func (b *builder) titlePage() {
+	metadata := b.book.Metadata
+
+	if cover, coverType := b.book.Cover(); cover != nil {
+		if m := b.addMedia(b.book.CoverName(), coverType, cover); m != nil {
+			p := b.paragraph("", document.AlignCenter, false)
+			b.drawing(p, m, metadata.Name, textHeightEMU*6/10)
+		}
+	}
+
+	b.text(b.paragraph("Title", document.AlignLeft, false), metadata.Name)
+	if metadata.Author != "" {
+		b.text(b.paragraph("Subtitle", document.AlignLeft, false), b.book.Labels().Byline(metadata.Author))
+	}
+
+	if description := strings.TrimSpace(metadata.Description); description != "" {
+		for _, line := range strings.Split(description, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				b.text(b.paragraph("", document.AlignLeft, false), line)
+			}
+		}
+	}
+
+	for _, field := range b.book.Fields() {
+		b.runs(b.paragraph("", document.AlignLeft, false), []document.Run{
+			{Text: field.Name + ": ", Bold: true},
+			{Text: field.Value},
+		})
+	}
+}
+
+// entry writes a chapter, or a story of an omnibus followed by its chapters,
+// starting on a new page under a heading of level.
+func (b *builder) entry(entry ebook.Entry, level int) error {
+	heading := b.paragraph(fmt.Sprintf("Heading%d", level), document.AlignLeft, true)
+	// links between chapters point at the bookmark of the heading
+	b.bookmark(heading, strings.TrimSuffix(entry.Href, path.Ext(entry.Href)), entry.Title)
+
+	if entry.Section != nil {
+		if entry.Section.Author != "" {
+			b.runs(b.paragraph("", document.AlignCenter, false), []document.Run{{Text: b.book.Labels().Byline(entry.Section.Author), Italic: true}})
+		}
+		if entry.Section.Cover != "" {
+			b.image(entry.Section.Cover, entry.Section.Title)
+		}
+		for _, child := range entry.Children {
+			if err := b.entry(child, level+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	blocks, err := document.Parse(entry.Chapter.Body)
+	if err != nil {
+		return fmt.Errorf("capítulo '%s': %w", entry.Title, err)
+	}
+	for _, block := range blocks {
+		b.block(block, level)
+	}
+	return nil
+}
+
+func (b *builder) block(block document.Block, level int) {
+	switch block.Kind {
+	case document.Image:
+		b.image(block.Image, block.Alt)
+	case document.Rule:
+		b.text(b.paragraph("", document.AlignCenter, false), "* * *")
+	case document.Heading:
+		b.runs(b.paragraph(fmt.Sprintf("Heading%d", min(block.Level+level, 6)), block.Align, false), block.Runs)
+	case document.Quote:
+		b.runs(b.paragraph("Quote", block.Align, false), block.Runs)
+	case document.Preformatted:
+		b.runs(b.paragraph("Code", document.AlignLeft, false), block.Runs)
+	default:
+		b.runs(b.paragraph("", block.Align, false), block.Runs)
+	}
+}
+
+var justification = map[document.Align]string{
+	document.AlignCenter:  "center",
+	document.AlignRight:   "right",
+	document.AlignJustify: "both",
+}
+
+// paragraph adds a paragraph with style, or Normal when it's empty.
+func (b *builder) paragraph(style string, align document.Align, pageBreak bool) *etree.Element {
+	p := b.body.CreateElement("w:p")
+	jc, aligned := justification[align]
+	if style == "" && !aligned && !pageBreak {
+		return p
+	}
+
+	// the properties have to be in the order of the schema
+	pPr := p.CreateElement("w:pPr")
+	if style != "" {
+		val(pPr, "w:pStyle", style)
+	}
+	if pageBreak {
+		pPr.CreateElement("w:pageBreakBefore")
+	}
+	if aligned {
+		val(pPr, "w:jc", jc)
+	}
+	return p
+}
+
+func (b *builder) text(p *etree.Element, text string) {
+	b.runs(p, []document.Run{{Text: text}})
+}
+
+// runs adds the text of runs to p, with their styles and links. Links to
+// another chapter go to its bookmark instead.
+func (b *builder) runs(p *etree.Element, runs []document.Run) {
+	var hyperlink *etree.Element
+	link := ""
+	for _, run := range runs {
+		parent := p
+		if run.Link != "" {
+			if run.Link != link || hyperlink == nil {
+				hyperlink = p.CreateElement("w:hyperlink")
+				if file, _, _ := strings.Cut(run.Link, "#"); strings.HasSuffix(file, ".xhtml") && !strings.Contains(file, ":") {
+					hyperlink.CreateAttr("w:anchor", strings.TrimSuffix(path.Base(file), ".xhtml"))
+				} else {
+					hyperlink.CreateAttr("r:id", b.link(run.Link))
+				}
+			}
+			parent = hyperlink
+		} else {
+			hyperlink = nil
+		}
+		link = run.Link
+
+		r := parent.CreateElement("w:r")
+		if run.Link != "" || run.Bold || run.Italic {
+			rPr := r.CreateElement("w:rPr")
+			if run.Link != "" {
+				val(rPr, "w:rStyle", "Hyperlink")
+			}
+			if run.Bold {
+				rPr.CreateElement("w:b")
+			}
+			if run.Italic {
+				rPr.CreateElement("w:i")
+			}
+		}
+		for i, piece := range strings.Split(run.Text, "\n") {
+			if i > 0 {
+				r.CreateElement("w:br")
+			}
+			if piece != "" {
+				t := r.CreateElement("w:t")
+				t.CreateAttr("xml:space", "preserve")
+				t.SetText(piece)
+			}
+		}
+	}
+}
+
+func (b *builder) link(url string) string {
+	if id, ok := b.links[url]; ok {
+		return id
+	}
+	id, rel := b.rel(relHyperlink, url)
+	rel.CreateAttr("TargetMode", "External")
+	b.links[url] = id
+	return id
+}
+
+// bookmark writes text to p inside a bookmark called name.
+func (b *builder) bookmark(p *etree.Element, name string, text string) {
+	b.bookmarks++
+	id := fmt.Sprint(b.bookmarks)
+	start := p.CreateElement("w:bookmarkStart")
+	start.CreateAttr("w:id", id)
+	start.CreateAttr("w:name", name)
+	b.text(p, text)
+	p.CreateElement("w:bookmarkEnd").CreateAttr("w:id", id)
+}
+
+// image adds a centered paragraph with the image called name, when the book
+// has it and it's in a format word processors read.
+func (b *builder) image(name string, alt string) {
+	img, ok := b.images[name]
+	if !ok {
+		return
+	}
+	if m := b.addMedia(img.Name, img.MediaType, img.Data); m != nil {
+		b.drawing(b.paragraph("", document.AlignCenter, false), m, alt, textHeightEMU)
+	}
+}
+
+// addMedia stores an image once, however many times it's used.
+func (b *builder) addMedia(name string, mediaType string, data []byte) *media {
+	if m, ok := b.mediaByID[name]; ok {
+		return m
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return nil
+	}
+
+	m := &media{name: name, mediaType: mediaType, data: data, width: config.Width, height: config.Height}
+	m.rel, _ = b.rel(relImage, "media/"+name)
+	b.media = append(b.media, m)
+	b.mediaByID[name] = m
+	return m
+}
+
+// drawing adds m to p as an inline picture at 96 dpi, shrunk to fit the
+// width of the text and maxHeight.
+func (b *builder) drawing(p *etree.Element, m *media, alt string, maxHeight int) {
+	cx, cy := m.width*emuPerPixel, m.height*emuPerPixel
+	if cx > textWidthEMU {
+		cx, cy = textWidthEMU, cy*textWidthEMU/cx
+	}
+	if cy > maxHeight {
+		cx, cy = cx*maxHeight/cy, maxHeight
+	}
+	b.drawings++
+	id := fmt.Sprint(b.drawings)
+
+	inline := p.CreateElement("w:r").CreateElement("w:drawing").CreateElement("wp:inline")
+	for _, attr := range []string{"distT", "distB", "distL", "distR"} {
+		inline.CreateAttr(attr, "0")
+	}
+	extent := inline.CreateElement("wp:extent")
+	extent.CreateAttr("cx", fmt.Sprint(cx))
+	extent.CreateAttr("cy", fmt.Sprint(cy))
+	docPr := inline.CreateElement("wp:docPr")
+	docPr.CreateAttr("id", id)
+	docPr.CreateAttr("name", "Picture "+id)
+	if alt != "" {
+		docPr.CreateAttr("descr", alt)
+	}
+	inline.CreateElement("wp:cNvGraphicFramePr").CreateElement("a:graphicFrameLocks").CreateAttr("noChangeAspect", "1")
+
+	data := inline.CreateElement("a:graphic").CreateElement("a:graphicData")
+	data.CreateAttr("uri", "http://schemas.openxmlformats.org/drawingml/2006/picture")
+	pic := data.CreateElement("pic:pic")
+	nvPicPr := pic.CreateElement("pic:nvPicPr")
+	cNvPr := nvPicPr.CreateElement("pic:cNvPr")
+	cNvPr.CreateAttr("id", id)
+	cNvPr.CreateAttr("name", m.name)
+	nvPicPr.CreateElement("pic:cNvPicPr")
+
+	fill := pic.CreateElement("pic:blipFill")
+	fill.CreateElement("a:blip").CreateAttr("r:embed", m.rel)
+	fill.CreateElement("a:stretch").CreateElement("a:fillRect")
+
+	spPr := pic.CreateElement("pic:spPr")
+	xfrm := spPr.CreateElement("a:xfrm")
+	off := xfrm.CreateElement("a:off")
+	off.CreateAttr("x", "0")
+	off.CreateAttr("y", "0")
+	ext := xfrm.CreateElement("a:ext")
+	ext.CreateAttr("cx", fmt.Sprint(cx))
+	ext.CreateAttr("cy", fmt.Sprint(cy))
+	geom := spPr.CreateElement("a:prstGeom")
+	geom.CreateAttr("prst", "rect")
+	geom.CreateElement("a:avLst")
+}
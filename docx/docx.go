@@ -0,0 +1,274 @@
+// Package docx writes a book as a Word document (Office Open XML) to be
+// edited and commented on in a word processor: a title page with the story
+// details, then every chapter on a new page under a Heading 1, keeping the
+// bold, italics, alignment, links and images of the chapter. It only uses
+// the standard library and etree.
+package docx
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"wattpad-to-ebook/ebook"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	wNamespace    = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	rNamespace    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	relsNamespace = "http://schemas.openxmlformats.org/package/2006/relationships"
+
+	relOfficeDocument = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument"
+	relCore           = "http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties"
+	relExtended       = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/extended-properties"
+	relStyles         = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles"
+	relImage          = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+	relHyperlink      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink"
+)
+
+// Write writes the Word document of book to w.
+func Write(w io.Writer, book *ebook.Book) error {
+	if len(book.Chapters()) == 0 {
+		return errors.New("o livro não tem nenhum capítulo")
+	}
+
+	b := newBuilder(book)
+	document, err := b.document()
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	parts := []struct {
+		name string
+		doc  *etree.Document
+	}{
+		{"[Content_Types].xml", contentTypes(b.media)},
+		{"_rels/.rels", packageRels()},
+		{"docProps/core.xml", coreProperties(book)},
+		{"docProps/app.xml", appProperties()},
+		{"word/document.xml", document},
+		{"word/styles.xml", styles(book.Language())},
+		{"word/_rels/document.xml.rels", b.rels},
+	}
+	for _, part := range parts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := part.doc.WriteTo(f); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range b.media {
+		f, err := archive.Create("word/media/" + m.name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(m.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// WriteFile writes the Word document of book to the file name.
+func WriteFile(name string, book *ebook.Book) error {
+	return ebook.CreateFile(name, func(w io.Writer) error {
+		return Write(w, book)
+	})
+}
+
+func newXML() *etree.Document {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8" standalone="yes"`)
+	return doc
+}
+
+// contentTypes lists the media type of every part, by extension for the
+// images.
+func contentTypes(media []*media) *etree.Document {
+	doc := newXML()
+	types := doc.CreateElement("Types")
+	types.CreateAttr("xmlns", "http://schemas.openxmlformats.org/package/2006/content-types")
+
+	defaults := map[string]string{
+		"rels": "application/vnd.openxmlformats-package.relationships+xml",
+		"xml":  "application/xml",
+	}
+	for _, m := range media {
+		defaults[strings.TrimPrefix(path.Ext(m.name), ".")] = m.mediaType
+	}
+	extensions := make([]string, 0, len(defaults))
+	for ext := range defaults {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+	for _, ext := range extensions {
+		def := types.CreateElement("Default")
+		def.CreateAttr("Extension", ext)
+		def.CreateAttr("ContentType", defaults[ext])
+	}
+
+	for _, override := range [][2]string{
+		{"/word/document.xml", "application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"},
+		{"/word/styles.xml", "application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"},
+		{"/docProps/core.xml", "application/vnd.openxmlformats-package.core-properties+xml"},
+		{"/docProps/app.xml", "application/vnd.openxmlformats-officedocument.extended-properties+xml"},
+	} {
+		o := types.CreateElement("Override")
+		o.CreateAttr("PartName", override[0])
+		o.CreateAttr("ContentType", override[1])
+	}
+	return doc
+}
+
+func packageRels() *etree.Document {
+	doc := newXML()
+	rels := doc.CreateElement("Relationships")
+	rels.CreateAttr("xmlns", relsNamespace)
+	addRel(rels, "rId1", relOfficeDocument, "word/document.xml")
+	addRel(rels, "rId2", relCore, "docProps/core.xml")
+	addRel(rels, "rId3", relExtended, "docProps/app.xml")
+	return doc
+}
+
+func addRel(rels *etree.Element, id string, kind string, target string) *etree.Element {
+	rel := rels.CreateElement("Relationship")
+	rel.CreateAttr("Id", id)
+	rel.CreateAttr("Type", kind)
+	rel.CreateAttr("Target", target)
+	return rel
+}
+
+// coreProperties is what word processors show as the properties of the
+// file: title, author, description and tags.
+func coreProperties(book *ebook.Book) *etree.Document {
+	metadata := book.Metadata
+
+	doc := newXML()
+	props := doc.CreateElement("cp:coreProperties")
+	props.CreateAttr("xmlns:cp", "http://schemas.openxmlformats.org/package/2006/metadata/core-properties")
+	props.CreateAttr("xmlns:dc", "http://purl.org/dc/elements/1.1/")
+	props.CreateAttr("xmlns:dcterms", "http://purl.org/dc/terms/")
+	props.CreateAttr("xmlns:xsi", "http://www.w3.org/2001/XMLSchema-instance")
+
+	props.CreateElement("dc:title").SetText(metadata.Name)
+	props.CreateElement("dc:creator").SetText(metadata.Author)
+	props.CreateElement("dc:language").SetText(book.Language())
+	if metadata.Description != "" {
+		props.CreateElement("dc:description").SetText(strings.TrimSpace(metadata.Description))
+	}
+	if len(metadata.Tags) > 0 {
+		props.CreateElement("cp:keywords").SetText(strings.Join(metadata.Tags, ", "))
+	}
+	created := props.CreateElement("dcterms:created")
+	created.CreateAttr("xsi:type", "dcterms:W3CDTF")
+	created.SetText(time.Now().UTC().Format(time.RFC3339))
+	return doc
+}
+
+func appProperties() *etree.Document {
+	doc := newXML()
+	props := doc.CreateElement("Properties")
+	props.CreateAttr("xmlns", "http://schemas.openxmlformats.org/officeDocument/2006/extended-properties")
+	props.CreateElement("Application").SetText("wattpad-to-ebook")
+	return doc
+}
+
+// styles defines the styles document.xml refers to, so the chapters show up
+// in the navigation pane of the word processor and can be restyled at once.
+// The language is set on all of them, for the spelling checker.
+func styles(lang string) *etree.Document {
+	doc := newXML()
+	root := doc.CreateElement("w:styles")
+	root.CreateAttr("xmlns:w", wNamespace)
+
+	defaults := root.CreateElement("w:docDefaults")
+	rPr := defaults.CreateElement("w:rPrDefault").CreateElement("w:rPr")
+	fonts := rPr.CreateElement("w:rFonts")
+	for _, attr := range []string{"w:ascii", "w:hAnsi", "w:cs", "w:eastAsia"} {
+		fonts.CreateAttr(attr, "Georgia")
+	}
+	val(rPr, "w:sz", "22")
+	val(rPr, "w:lang", lang)
+	spacing := defaults.CreateElement("w:pPrDefault").CreateElement("w:pPr").CreateElement("w:spacing")
+	spacing.CreateAttr("w:after", "160")
+	spacing.CreateAttr("w:line", "276")
+	spacing.CreateAttr("w:lineRule", "auto")
+
+	normal := style(root, "paragraph", "Normal", "Normal")
+	normal.CreateAttr("w:default", "1")
+
+	title := style(root, "paragraph", "Title", "Title")
+	val(title.CreateElement("w:pPr"), "w:jc", "center")
+	titleRun := title.CreateElement("w:rPr")
+	titleRun.CreateElement("w:b")
+	val(titleRun, "w:sz", "52")
+
+	subtitle := style(root, "paragraph", "Subtitle", "Subtitle")
+	val(subtitle.CreateElement("w:pPr"), "w:jc", "center")
+	subtitleRun := subtitle.CreateElement("w:rPr")
+	subtitleRun.CreateElement("w:i")
+	val(subtitleRun, "w:sz", "28")
+
+	sizes := []string{"36", "30", "26", "24", "22", "22"}
+	for i, size := range sizes {
+		level := string(rune('1' + i))
+		heading := style(root, "paragraph", "Heading"+level, "heading "+level)
+		val(heading, "w:basedOn", "Normal")
+		val(heading, "w:next", "Normal")
+		pPr := heading.CreateElement("w:pPr")
+		pPr.CreateElement("w:keepNext")
+		before := pPr.CreateElement("w:spacing")
+		before.CreateAttr("w:before", "360")
+		before.CreateAttr("w:after", "240")
+		val(pPr, "w:outlineLvl", string(rune('0'+i)))
+		headingRun := heading.CreateElement("w:rPr")
+		headingRun.CreateElement("w:b")
+		val(headingRun, "w:sz", size)
+	}
+
+	quote := style(root, "paragraph", "Quote", "Quote")
+	val(quote, "w:basedOn", "Normal")
+	ind := quote.CreateElement("w:pPr").CreateElement("w:ind")
+	ind.CreateAttr("w:left", "720")
+	ind.CreateAttr("w:right", "720")
+	quote.CreateElement("w:rPr").CreateElement("w:i")
+
+	code := style(root, "paragraph", "Code", "Code")
+	val(code, "w:basedOn", "Normal")
+	codeRun := code.CreateElement("w:rPr")
+	codeFonts := codeRun.CreateElement("w:rFonts")
+	codeFonts.CreateAttr("w:ascii", "Courier New")
+	codeFonts.CreateAttr("w:hAnsi", "Courier New")
+	val(codeRun, "w:sz", "20")
+
+	link := style(root, "character", "Hyperlink", "Hyperlink")
+	linkRun := link.CreateElement("w:rPr")
+	val(linkRun, "w:color", "0563C1")
+	val(linkRun, "w:u", "single")
+	return doc
+}
+
+func style(root *etree.Element, kind string, id string, name string) *etree.Element {
+	s := root.CreateElement("w:style")
+	s.CreateAttr("w:type", kind)
+	s.CreateAttr("w:styleId", id)
+	val(s, "w:name", name)
+	return s
+}
+
+// val adds the element tag with a w:val attribute, the way most of
+// WordprocessingML sets a property.
+func val(parent *etree.Element, tag string, value string) *etree.Element {
+	e := parent.CreateElement(tag)
+	e.CreateAttr("w:val", value)
+	return e
+}
@@ -0,0 +1,93 @@
+package ebook
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// accessibilityMetas is the schema.org accessibility metadata of the
+// package, from EPUB Accessibility 1.1, telling readers and stores what the
+// book needs and offers before it's opened.
+func (b *Book) accessibilityMetas() []Meta {
+	hasImages := len(b.images) > 0
+	animated := false
+	for _, img := range b.images {
+		// a GIF may flash, and there's no telling without playing it
+		animated = animated || img.MediaType == "image/gif"
+	}
+	// the images only count as described when every one of them has an alt
+	images, described := b.describedImages()
+	allDescribed := hasImages && images == described
+
+	meta := func(property string, value string) Meta {
+		return Meta{Property: "schema:" + property, Content: value}
+	}
+
+	metas := []Meta{meta("accessMode", "textual")}
+	if hasImages || len(b.cover) > 0 {
+		metas = append(metas, meta("accessMode", "visual"))
+	}
+	if hasImages {
+		metas = append(metas, meta("accessModeSufficient", "textual,visual"))
+	}
+	if !hasImages || allDescribed {
+		metas = append(metas, meta("accessModeSufficient", "textual"))
+	}
+
+	for _, feature := range []string{"structuralNavigation", "tableOfContents", "readingOrder"} {
+		metas = append(metas, meta("accessibilityFeature", feature))
+	}
+	if allDescribed {
+		metas = append(metas, meta("accessibilityFeature", "alternativeText"))
+	}
+
+	if animated {
+		metas = append(metas,
+			meta("accessibilityHazard", "unknownFlashingHazard"),
+			meta("accessibilityHazard", "noMotionSimulationHazard"),
+			meta("accessibilityHazard", "noSoundHazard"))
+	} else {
+		metas = append(metas, meta("accessibilityHazard", "none"))
+	}
+
+	summary := "The chapters are marked up as sections with a heading each, listed in the table of contents in reading order."
+	switch {
+	case allDescribed:
+		summary += " Every image has alternative text."
+	case hasImages:
+		summary += " Some images have no alternative text, as the story's site doesn't ask authors for one."
+	}
+	return append(metas, meta("accessibilitySummary", summary))
+}
+
+// describedImages counts the images of the chapters, and how many of them
+// have an alt text that isn't empty.
+func (b *Book) describedImages() (images int, described int) {
+	for _, chapter := range b.chapters {
+		z := html.NewTokenizer(strings.NewReader(chapter.Body))
+		for {
+			tt := z.Next()
+			if tt == html.ErrorToken {
+				break
+			}
+			if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+				continue
+			}
+			name, more := z.TagName()
+			if string(name) != "img" {
+				continue
+			}
+			images++
+			for more {
+				var key, value []byte
+				key, value, more = z.TagAttr()
+				if string(key) == "alt" && strings.TrimSpace(string(value)) != "" {
+					described++
+					break
+				}
+			}
+		}
+	}
+	return images, described
+}
@@ -0,0 +1,429 @@
+package ebook
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"wattpad-to-ebook/sources"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/yosssi/gohtml"
+)
+
+// Book collects everything that goes into an EPUB in memory (metadata, cover,
+// chapters, images and styles) and streams it straight into a zip, so no
+// temporary directory is needed.
+type Book struct {
+	Metadata sources.Story_Metadata
+
+	cover     []byte
+	coverType string
+	chapters  []Chapter
+	sections  []Section
+	images    []Image
+	imageSet  map[string]bool
+	// created is when the story was downloaded, shown on the title page
+	created time.Time
+	// kepub is set by Kepub, for the pages made when the book is written
+	kepub bool
+}
+
+// Chapter is a chapter as it was added to the book.
+type Chapter struct {
+	Index int
+	// Section is the Index of the section the chapter belongs to, 0 for none.
+	Section int
+	Title   string
+	// ID and Href are the manifest id and file name, e.g. chapter_3 and chapter_3.xhtml.
+	ID   string
+	Href string
+	// Body is the chapter HTML as it was added, with image sources pointing
+	// at ../images/. The XHTML in the book is a formatted copy of it.
+	Body  string
+	xhtml []byte
+}
+
+// Section is one story of a book made of several, like an omnibus. It has a
+// title page, and its chapters are nested under it in the table of contents.
+type Section struct {
+	Index  int
+	Title  string
+	Author string
+	// ID and Href are the manifest id and file name of the title page, e.g.
+	// story_2 and story_2.xhtml.
+	ID   string
+	Href string
+	// Cover is the name of the section cover under images/, empty when there is none.
+	Cover string
+	xhtml []byte
+}
+
+// Image is a file stored under images/ in the book.
+type Image struct {
+	Name      string
+	Data      []byte
+	MediaType string
+}
+
+// NewBook starts a book with the metadata of a story, using its cover if it has one.
+func NewBook(metadata sources.Story_Metadata) *Book {
+	b := &Book{Metadata: metadata, imageSet: map[string]bool{}, created: time.Now()}
+	b.SetCover(metadata.CoverImage, metadata.CoverImageType)
+	return b
+}
+
+func (b *Book) SetCover(data []byte, mediaType string) {
+	b.cover = data
+	b.coverType = mediaType
+	if len(data) > 0 && mediaType == "" {
+		b.coverType = mimetype.Detect(data).String()
+	}
+}
+
+// AddChapter converts body to XHTML and adds it as chapter_<index>.xhtml.
+// Chapters are kept in the order they were added.
+func (b *Book) AddChapter(index int, title string, body string) error {
+	return b.AddSectionChapter(0, index, title, body)
+}
+
+// AddSection starts a new section with a title page showing title, author and
+// cover, and returns its Index for AddSectionChapter. cover can be nil.
+func (b *Book) AddSection(title string, author string, cover []byte, coverType string) (int, error) {
+	section := Section{
+		Index:  len(b.sections) + 1,
+		Title:  title,
+		Author: author,
+	}
+	section.ID = fmt.Sprintf("story_%d", section.Index)
+	section.Href = section.ID + ".xhtml"
+
+	if len(cover) > 0 {
+		img := Image{Data: cover, MediaType: coverType}
+		if img.MediaType == "" {
+			img.MediaType = mimetype.Detect(cover).String()
+		}
+		img.Name = fmt.Sprintf("story%d_cover.%s", section.Index, getImageExt(img.MediaType))
+		if err := b.AddImage(img); err != nil {
+			return 0, err
+		}
+		section.Cover = img.Name
+	}
+
+	xhtml, err := GenerateXHTML(title, b.Language(), sectionPage(section, b.Labels()))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", title, err)
+	}
+	section.xhtml = xhtml
+
+	b.sections = append(b.sections, section)
+	return section.Index, nil
+}
+
+// sectionPage is the body of the title page of a section.
+func sectionPage(section Section, labels Labels) string {
+	var page strings.Builder
+	page.WriteString(`<section class="title-page">`)
+	fmt.Fprintf(&page, "<h1>%s</h1>", html.EscapeString(section.Title))
+	if section.Author != "" {
+		fmt.Fprintf(&page, "<p>%s</p>", html.EscapeString(labels.Byline(section.Author)))
+	}
+	if section.Cover != "" {
+		fmt.Fprintf(&page, `<img src="../images/%s" alt="%s" width="100%%"/>`, section.Cover, html.EscapeString(section.Title))
+	}
+	page.WriteString("</section>")
+	return page.String()
+}
+
+// chapterPage puts the chapter title on top of body, in a section marked as
+// a chapter for assistive technology and reading systems.
+func chapterPage(title string, body string) string {
+	return fmt.Sprintf(`<section epub:type="chapter" role="doc-chapter"><h1>%s</h1>%s</section>`, html.EscapeString(title), body)
+}
+
+// AddSectionChapter adds a chapter to the section returned by AddSection, as
+// story<section>_chapter_<index>.xhtml so chapters of different sections
+// don't collide. Section 0 is the same as AddChapter.
+func (b *Book) AddSectionChapter(section int, index int, title string, body string) error {
+	if section < 0 || section > len(b.sections) {
+		return fmt.Errorf("a seção %d não existe", section)
+	}
+
+	chapter := Chapter{
+		Index:   index,
+		Section: section,
+		Title:   title,
+		ID:      fmt.Sprintf("chapter_%d", index),
+		Body:    body,
+	}
+	if section > 0 {
+		chapter.ID = fmt.Sprintf("story%d_chapter_%d", section, index)
+	}
+	chapter.Href = chapter.ID + ".xhtml"
+
+	for _, c := range b.chapters {
+		if c.ID == chapter.ID {
+			return fmt.Errorf("o capítulo %d foi adicionado duas vezes", index)
+		}
+	}
+
+	xhtml, err := GenerateXHTML(title, b.Language(), chapterPage(title, gohtml.Format(body)))
+	if err != nil {
+		return fmt.Errorf("%s: %w", title, err)
+	}
+	chapter.xhtml = xhtml
+
+	b.chapters = append(b.chapters, chapter)
+	return nil
+}
+
+// AddImage stores an image under images/. The media type is detected from the
+// content when img doesn't have one.
+func (b *Book) AddImage(img Image) error {
+	if b.imageSet[img.Name] {
+		return fmt.Errorf("a imagem %s foi adicionada duas vezes", img.Name)
+	}
+	if img.MediaType == "" {
+		img.MediaType = mimetype.Detect(img.Data).String()
+	}
+
+	b.imageSet[img.Name] = true
+	b.images = append(b.images, img)
+	return nil
+}
+
+func (b *Book) Chapters() []Chapter {
+	return b.chapters
+}
+
+func (b *Book) Sections() []Section {
+	return b.sections
+}
+
+func (b *Book) Images() []Image {
+	return b.images
+}
+
+// Cover returns the cover image and its media type, nil when there is none.
+func (b *Book) Cover() ([]byte, string) {
+	return b.cover, b.coverType
+}
+
+// CoverName is the file name of the cover under images/.
+func (b *Book) CoverName() string {
+	return "cover." + getImageExt(b.coverType)
+}
+
+// document is an XHTML file of the book, chapter or section title page.
+type document struct {
+	id    string
+	href  string
+	xhtml []byte
+}
+
+// documents lists the XHTML files in reading order: the front matter, then
+// the pages of TOC. The front matter is made anew on every call, so a write
+// calls it once and passes the result along.
+func (b *Book) documents() ([]document, error) {
+	docs, err := b.frontMatter()
+	if err != nil {
+		return nil, err
+	}
+	var walk func(entries []Entry)
+	walk = func(entries []Entry) {
+		for _, entry := range entries {
+			if entry.Section != nil {
+				docs = append(docs, document{id: entry.Section.ID, href: entry.Section.Href, xhtml: entry.Section.xhtml})
+			} else {
+				docs = append(docs, document{id: entry.Chapter.ID, href: entry.Chapter.Href, xhtml: entry.Chapter.xhtml})
+			}
+			walk(entry.Children)
+		}
+	}
+	walk(b.TOC())
+	return docs, nil
+}
+
+// Entry is an item of the table of contents: a chapter, or a section with
+// its chapters as Children.
+type Entry struct {
+	Title    string
+	Href     string
+	Chapter  *Chapter
+	Section  *Section
+	Children []Entry
+}
+
+// TOC is the table of contents of the book, in reading order: the chapters
+// outside any section first, then every section with its chapters nested.
+// Other output formats walk it to lay the book out the same way.
+func (b *Book) TOC() []Entry {
+	chapterEntries := func(section int) []Entry {
+		var entries []Entry
+		for i := range b.chapters {
+			if chap := &b.chapters[i]; chap.Section == section {
+				entries = append(entries, Entry{Title: chap.Title, Href: chap.Href, Chapter: chap})
+			}
+		}
+		return entries
+	}
+
+	entries := chapterEntries(0)
+	for i := range b.sections {
+		section := &b.sections[i]
+		entries = append(entries, Entry{Title: section.Title, Href: section.Href, Section: section, Children: chapterEntries(section.Index)})
+	}
+	return entries
+}
+
+func (b *Book) navItems() []ChapterNavItem {
+	return toNavItems(b.TOC())
+}
+
+func toNavItems(entries []Entry) []ChapterNavItem {
+	var items []ChapterNavItem
+	for _, entry := range entries {
+		items = append(items, ChapterNavItem{Href: entry.Href, Title: entry.Title, Children: toNavItems(entry.Children)})
+	}
+	return items
+}
+
+// WriteTo writes the whole EPUB to w, so it implements io.WriterTo.
+func (b *Book) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	zipWriter := zip.NewWriter(cw)
+
+	if err := b.writeZip(zipWriter); err != nil {
+		return cw.n, err
+	}
+	err := zipWriter.Close()
+	return cw.n, err
+}
+
+// WriteFile writes the EPUB to name. A half-written file is removed on error.
+func (b *Book) WriteFile(name string) error {
+	return CreateFile(name, func(w io.Writer) error {
+		_, err := b.WriteTo(w)
+		return err
+	})
+}
+
+// CreateFile creates name, has fill write to it and removes it again when
+// fill fails, so no half written file is left behind. Every format writes
+// its files with it.
+func CreateFile(name string, fill func(w io.Writer) error) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = fill(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+	return err
+}
+
+func (b *Book) writeZip(w *zip.Writer) error {
+	if len(b.chapters) == 0 {
+		return errors.New("o livro não tem nenhum capítulo")
+	}
+
+	// o mimetype tem que ser o primeiro arquivo, e sem compressão
+	if err := createMimetype(w); err != nil {
+		return err
+	}
+
+	container, err := BuildContainerXML("OEBPS/content.opf", "application/oebps-package+xml")
+	if err != nil {
+		return err
+	}
+	if err := addFile(w, "META-INF/container.xml", container); err != nil {
+		return err
+	}
+
+	docs, err := b.documents()
+	if err != nil {
+		return err
+	}
+
+	opf, err := contentOPF(b, docs)
+	if err != nil {
+		return err
+	}
+	if err := addFile(w, "OEBPS/content.opf", opf); err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		if err := addFile(w, "OEBPS/"+doc.href, doc.xhtml); err != nil {
+			return err
+		}
+	}
+
+	if err := addFile(w, "style/main.css", []byte(css_main())); err != nil {
+		return err
+	}
+	if err := addFile(w, "style/nav.css", []byte(css_nav())); err != nil {
+		return err
+	}
+
+	// the front matter is only listed in the EPUB, other formats have their own
+	navItems := append(b.frontNavItems(), b.navItems()...)
+	nav, err := GenerateNavXHTML(b.Metadata.Name, b.Language(), navItems, b.landmarks())
+	if err != nil {
+		return err
+	}
+	if err := addFile(w, "OEBPS/nav.xhtml", []byte(nav)); err != nil {
+		return err
+	}
+
+	toc, err := GenerateTOCNCX(b.Metadata.Name, b.Identifier(), navItems)
+	if err != nil {
+		return err
+	}
+	if err := addFile(w, "OEBPS/toc.ncx", toc); err != nil {
+		return err
+	}
+
+	if len(b.cover) > 0 {
+		if err := addFile(w, b.CoverName(), b.cover); err != nil {
+			return err
+		}
+	}
+
+	for _, img := range b.images {
+		if err := addFile(w, "images/"+img.Name, img.Data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addFile(w *zip.Writer, name string, content []byte) error {
+	f, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -6,9 +6,7 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"mime"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -45,10 +43,11 @@ type NCXNavMap struct {
 }
 
 type NCXNavPoint struct {
-	ID        string       `xml:"id,attr"`
-	PlayOrder int          `xml:"playOrder,attr"`
-	NavLabel  NCXLabel     `xml:"navLabel"`
-	Content   NCXContent   `xml:"content"`
+	ID        string        `xml:"id,attr"`
+	PlayOrder int           `xml:"playOrder,attr"`
+	NavLabel  NCXLabel      `xml:"navLabel"`
+	Content   NCXContent    `xml:"content"`
+	NavPoints []NCXNavPoint `xml:"navPoint"`
 }
 
 type NCXLabel struct {
@@ -66,7 +65,7 @@ func GenerateTOCNCX(title string, uid string, chapters []ChapterNavItem) ([]byte
 		Head: NCXHead{
 			Metas: []NCXMeta{
 				{Name: "dtb:uid", Content: uid},
-				{Name: "dtb:depth", Content: "1"},
+				{Name: "dtb:depth", Content: strconv.Itoa(max(navDepth(chapters), 1))},
 				{Name: "dtb:totalPageCount", Content: "0"},
 				{Name: "dtb:maxPageNumber", Content: "0"},
 			},
@@ -74,15 +73,8 @@ func GenerateTOCNCX(title string, uid string, chapters []ChapterNavItem) ([]byte
 		Title: NCXTitle{Text: title},
 	}
 
-	for i, chap := range chapters {
-		navPoint := NCXNavPoint{
-			ID:        fmt.Sprintf("chapter_%d", i+1),
-			PlayOrder: i + 1,
-			NavLabel:  NCXLabel{Text: chap.Title},
-			Content:   NCXContent{Src: chap.Href},
-		}
-		toc.NavMap.NavPoints = append(toc.NavMap.NavPoints, navPoint)
-	}
+	playOrder := 0
+	toc.NavMap.NavPoints = ncxNavPoints(chapters, &playOrder)
 
 	var buf bytes.Buffer
 	buf.WriteString(`<?xml version='1.0' encoding='utf-8'?>` + "\n")
@@ -149,23 +141,30 @@ type Package struct {
 	Metadata         Metadata  `xml:"metadata"`
 	Manifest         Manifest  `xml:"manifest"`
 	Spine            Spine     `xml:"spine"`
+	// Guide is the EPUB 2 version of the landmarks, for older readers and
+	// Kindle converters
+	Guide            *Guide    `xml:"guide,omitempty"`
 }
 
 type Metadata struct {
 	XMLNSDC     string      `xml:"xmlns:dc,attr"`
 	XMLNSOPF    string      `xml:"xmlns:opf,attr"`
-	Modified    Meta        `xml:"meta"`
+	Metas       []Meta      `xml:"meta"`
 	// Generator   MetaSimple  `xml:"meta"`
-	Identifier  Identifier  `xml:"dc:identifier"`
+	Identifiers []Identifier `xml:"dc:identifier"`
 	Title       string      `xml:"dc:title"`
 	Language    string      `xml:"dc:language"`
 	Creator     Creator     `xml:"dc:creator"`
 	Description string      `xml:"dc:description"`
 }
 
+// Meta is an EPUB 3 <meta property="...">value</meta>, or with Name and
+// ContentAttr an EPUB 2 <meta name="..." content="..."/>.
 type Meta struct {
-	Property string `xml:"property,attr"`
-	Content  string `xml:",chardata"`
+	Property    string `xml:"property,attr,omitempty"`
+	Name        string `xml:"name,attr,omitempty"`
+	ContentAttr string `xml:"content,attr,omitempty"`
+	Content     string `xml:",chardata"`
 }
 
 type MetaSimple struct {
@@ -203,12 +202,76 @@ type Itemref struct {
 	IDRef string `xml:"idref,attr"`
 }
 
+type Guide struct {
+	References []Reference `xml:"reference"`
+}
+
+type Reference struct {
+	Type  string `xml:"type,attr"`
+	Title string `xml:"title,attr"`
+	Href  string `xml:"href,attr"`
+}
+
 type ChapterNavItem struct {
 	Href  string
 	Title string
+	// Children are nested under this entry, like the parts of a story in an omnibus.
+	Children []ChapterNavItem
+}
+
+// Landmark is a page readers can jump to, listed in the landmarks nav and in
+// the guide of the package.
+type Landmark struct {
+	// Type is the epub:type of the landmark, like bodymatter, and GuideType
+	// the EPUB 2 guide type for the same page, like text.
+	Type      string
+	GuideType string
+	Title     string
+	Href      string
+}
+
+// navDepth is how many levels chapters nest, 1 for a flat list.
+func navDepth(chapters []ChapterNavItem) int {
+	depth := 0
+	for _, chap := range chapters {
+		depth = max(depth, 1+navDepth(chap.Children))
+	}
+	return depth
+}
+
+// ncxNavPoints turns chapters into navPoints, numbering them in reading order.
+func ncxNavPoints(chapters []ChapterNavItem, playOrder *int) []NCXNavPoint {
+	var navPoints []NCXNavPoint
+	for _, chap := range chapters {
+		*playOrder++
+		navPoint := NCXNavPoint{
+			ID:        fmt.Sprintf("navpoint_%d", *playOrder),
+			PlayOrder: *playOrder,
+			NavLabel:  NCXLabel{Text: chap.Title},
+			Content:   NCXContent{Src: chap.Href},
+		}
+		navPoint.NavPoints = ncxNavPoints(chap.Children, playOrder)
+		navPoints = append(navPoints, navPoint)
+	}
+	return navPoints
 }
 
-func GenerateNavXHTML(bookTitle string, chapters []ChapterNavItem) (string, error) {
+// addNavList adds chapters to parent as an ol, with an ol nested in the li of
+// every entry that has children.
+func addNavList(parent *etree.Element, chapters []ChapterNavItem) {
+	ol := parent.CreateElement("ol")
+	for _, chap := range chapters {
+		li := ol.CreateElement("li")
+		a := li.CreateElement("a")
+		a.CreateAttr("href", chap.Href)
+		a.SetText(chap.Title)
+		if len(chap.Children) > 0 {
+			addNavList(li, chap.Children)
+		}
+	}
+}
+
+func GenerateNavXHTML(bookTitle string, lang string, chapters []ChapterNavItem, landmarks []Landmark) (string, error) {
 	doc := etree.NewDocument()
 	doc.CreateProcInst("xml", `version='1.0' encoding='utf-8'`)
 	// doc.CreateDocType("html", "", "", "")
@@ -216,8 +279,8 @@ func GenerateNavXHTML(bookTitle string, chapters []ChapterNavItem) (string, erro
 	html := doc.CreateElement("html")
 	html.CreateAttr("xmlns", "http://www.w3.org/1999/xhtml")
 	html.CreateAttr("xmlns:epub", "http://www.idpf.org/2007/ops")
-	html.CreateAttr("lang", "en")
-	html.CreateAttr("xml:lang", "en")
+	html.CreateAttr("lang", lang)
+	html.CreateAttr("xml:lang", lang)
 
 	head := html.CreateElement("head")
 	head.CreateElement("title").SetText(bookTitle)
@@ -229,17 +292,28 @@ func GenerateNavXHTML(bookTitle string, chapters []ChapterNavItem) (string, erro
 	body := html.CreateElement("body")
 	nav := body.CreateElement("nav")
 	nav.CreateAttr("epub:type", "toc")
-	nav.CreateAttr("id", "id")
+	nav.CreateAttr("id", "toc")
 	nav.CreateAttr("role", "doc-toc")
 
 	nav.CreateElement("h2").SetText(bookTitle)
 
-	ol := nav.CreateElement("ol")
-	for _, chap := range chapters {
-		li := ol.CreateElement("li")
-		a := li.CreateElement("a")
-		a.CreateAttr("href", chap.Href)
-		a.SetText(chap.Title)
+	addNavList(nav, chapters)
+
+	// readers use the landmarks to open the book and for "go to beginning",
+	// they aren't shown as part of the page
+	if len(landmarks) > 0 {
+		guide := body.CreateElement("nav")
+		guide.CreateAttr("epub:type", "landmarks")
+		guide.CreateAttr("id", "landmarks")
+		guide.CreateAttr("hidden", "hidden")
+		guide.CreateElement("h2").SetText("Guide")
+		ol := guide.CreateElement("ol")
+		for _, landmark := range landmarks {
+			a := ol.CreateElement("li").CreateElement("a")
+			a.CreateAttr("epub:type", landmark.Type)
+			a.CreateAttr("href", landmark.Href)
+			a.SetText(landmark.Title)
+		}
 	}
 
 	doc.Indent(2)
@@ -248,49 +322,79 @@ func GenerateNavXHTML(bookTitle string, chapters []ChapterNavItem) (string, erro
 
 
 
-func GenerateContentOPF(title, author, description string, chapterCount int, img_type string, imgDir []os.DirEntry) ([]byte, error) {
+// GenerateContentOPF makes the package document of b on its own; writing
+// the book makes it from the documents it writes, with contentOPF.
+func GenerateContentOPF(b *Book) ([]byte, error) {
+	docs, err := b.documents()
+	if err != nil {
+		return nil, err
+	}
+	return contentOPF(b, docs)
+}
+
+func contentOPF(b *Book, docs []document) ([]byte, error) {
 	chapters := make([]Item, 0)
 	var refs []Itemref
 
 	// refs = append(refs, Itemref{IDRef: "style_nav"})
 
-	for i := range chapterCount {
+	// the title page and introduction come first, see frontMatter
+	for _, doc := range docs {
 		refs = append(refs, 
-		Itemref{IDRef: fmt.Sprintf("chapter_%d", i+1)})
+		Itemref{IDRef: doc.id})
 	}
-	// // Introduction
-	// chapters = append(chapters, Item{Href: "introduction.xhtml", ID: "chapter_0", MediaType: "application/xhtml+xml"})
-	// refs = append(refs, Itemref{IDRef: "chapter_0"})
 
-	
 
 	// Nav
 	chapters = append(chapters, Item{Href: "nav.xhtml", ID: "nav", MediaType: "application/xhtml+xml", Properties: "nav"})
 
-	img_ext := getImageExt(img_type)
 	// Static entries
 	staticItems := []Item{
 		{Href: "../style/main.css", ID: "doc_style", MediaType: "text/css"},
 		{Href: "../style/nav.css", ID: "style_nav", MediaType: "text/css"},
-		{Href: fmt.Sprintf("../cover.%s", img_ext), ID: "cover", MediaType: img_type, Properties: "cover-image"},
-		{Href: "toc.ncx", ID: "ncx", MediaType: "application/x-dtbncx+xml"},
 	}
 
-	for i := range chapterCount {
+	if len(b.cover) > 0 {
+		staticItems = append(staticItems,
+			Item{Href: "../" + b.CoverName(), ID: "cover", MediaType: b.coverType, Properties: "cover-image"})
+	}
+
+	staticItems = append(staticItems, Item{Href: "toc.ncx", ID: "ncx", MediaType: "application/x-dtbncx+xml"})
+
+	for _, doc := range docs {
 		staticItems = append(staticItems, 
-			Item{Href: fmt.Sprintf("chapter_%d.xhtml", i+1), ID: fmt.Sprintf("chapter_%d", i+1), MediaType: "application/xhtml+xml"},)
+			Item{Href: doc.href, ID: doc.id, MediaType: "application/xhtml+xml"},)
 	}
 
-	for _, i := range imgDir {
-		generalImg := strings.Split(i.Name(), ".")
+	for _, img := range b.images {
 		staticItems = append(staticItems, 
-		Item{Href: fmt.Sprintf("../images/%s", i.Name()), ID: generalImg[0], MediaType: mime.TypeByExtension(fmt.Sprintf(".%s", generalImg[1]))},
+		Item{Href: fmt.Sprintf("../images/%s", img.Name), ID: strings.Split(img.Name, ".")[0], MediaType: img.MediaType},
 		)
 
 	}
 
 	manifest := Manifest{Items: append(staticItems, chapters...)}
 
+	metas := []Meta{{Property: "dcterms:modified", Content: time.Now().UTC().Format(time.RFC3339)}}
+	if len(b.cover) > 0 {
+		// EPUB 2 readers and Kindle converters find the cover through this
+		metas = append(metas, Meta{Name: "cover", ContentAttr: "cover"})
+	}
+	metas = append(metas, b.accessibilityMetas()...)
+
+	var guide *Guide
+	if landmarks := b.landmarks(); len(landmarks) > 0 {
+		guide = &Guide{}
+		for _, landmark := range landmarks {
+			guide.References = append(guide.References, Reference{Type: landmark.GuideType, Title: landmark.Title, Href: landmark.Href})
+		}
+	}
+
+	identifiers := []Identifier{{ID: "id", Body: b.Identifier()}}
+	if source := b.SourceIdentifier(); source != "" {
+		identifiers = append(identifiers, Identifier{ID: "source-id", Body: source})
+	}
+
 	pkg := Package{
 		Xmlns:            "http://www.idpf.org/2007/opf",
 		UniqueIdentifier: "id",
@@ -299,16 +403,17 @@ func GenerateContentOPF(title, author, description string, chapterCount int, img
 		Metadata: Metadata{
 			XMLNSDC:     "http://purl.org/dc/elements/1.1/",
 			XMLNSOPF:    "http://www.idpf.org/2007/opf",
-			Modified:    Meta{Property: "dcterms:modified", Content: time.Now().UTC().Format(time.RFC3339)},
+			Metas:       metas,
 			// Generator:   MetaSimple{Name: "generator", Content: "YourGenerator 1.0"},
-			Identifier:  Identifier{ID: "id", Body: "quikmcbu"},
-			Title:       title,
-			Language:    "en",
-			Creator:     Creator{ID: "creator", Body: author},
-			Description: description,
+			Identifiers: identifiers,
+			Title:       b.Metadata.Name,
+			Language:    b.Language(),
+			Creator:     Creator{ID: "creator", Body: b.Metadata.Author},
+			Description: b.Metadata.Description,
 		},
 		Manifest: manifest,
 		Spine:    Spine{Toc: "ncx", Itemrefs: refs},
+		Guide:    guide,
 	}
 
 	buf := &bytes.Buffer{}
@@ -378,17 +483,8 @@ func getBodyNodeFromHTML(rawFormatted string) (*html.Node, error) {
 }
 
 
-func SetupImg(tempDir string) error {
-	err := os.MkdirAll(filepath.Join(tempDir, "images"), os.ModePerm)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
 
-func GenerateXHTML(title string, bodyContent string) ([]byte, error) {
+func GenerateXHTML(title string, lang string, bodyContent string) ([]byte, error) {
 	// Step 1: Parse HTML5 body content
 
 	doc, err := getBodyNodeFromHTML(bodyContent)
@@ -409,8 +505,8 @@ func GenerateXHTML(title string, bodyContent string) ([]byte, error) {
 		Xmlns:      "http://www.w3.org/1999/xhtml",
 		XmlnsEpub:  "http://www.idpf.org/2007/ops",
 		EpubPrefix: "z3998: http://www.daisy.org/z3998/2012/vocab/structure/#",
-		Lang:       "en",
-		XmlLang:    "en",
+		Lang:       lang,
+		XmlLang:    lang,
 		Head: Head{
 			Title: title,
 			Link: Link{
@@ -437,14 +533,6 @@ func GenerateXHTML(title string, bodyContent string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func Setup_temp()(string, error){
-	tempDir, err := os.MkdirTemp("", "epub-story-")
-
-	if err != nil {
-		return "", err
-	}
-	return tempDir, nil
-}
 
 func css_main() string{
 	main := 
@@ -481,6 +569,15 @@ ol > li > ol {
     margin-left: 0.5em;
 }
 
+section.cover {
+    text-align: center;
+}
+
+section.cover img {
+    max-width: 100%;
+    max-height: 100%;
+}
+
 .spoiler {
     padding-left: 0.4em;
     border-left: 0.2em solid #c7ccd1;
@@ -489,161 +586,8 @@ ol > li > ol {
 	return main
 }
 
-
-
-func Setup_CSS(tempDir string) (error) {
-	err := os.MkdirAll(filepath.Join(tempDir, "style"), os.ModePerm)
-	if err != nil {
-		return err
-	}
-
-	cssMain := filepath.Join(tempDir, "style", "main.css")
-	navCSS := filepath.Join(tempDir, "style", "nav.css")
-
-	file, err := os.Create(cssMain)
-
-	if err != nil {
-		return err
-	}
-
-	file.WriteString(css_main())
-	file.Close()
-
-	file, err = os.Create(navCSS)
-	if err != nil {
-		return err
-	}
-
-	file.WriteString("BODY {color: white;}")
-	file.Close()
-	return nil
-}
-
-
-func Setup_container(tempDir string) (error) {
-	err := os.MkdirAll(filepath.Join(tempDir, "META-INF"), os.ModePerm)
-
-	if err != nil {
-		return err
-	}
-	containerPath := filepath.Join(tempDir, "META-INF", "container.xml")
-
-	containerFile, err := os.Create(containerPath)
-
-	if err != nil {
-		return err
-	}
-
-	containerContent, err := BuildContainerXML("OEBPS/content.opf", "application/oebps-package+xml")
-  	if err != nil {
-    	return err
-  	}
-	containerFile.Write(containerContent)
-	containerFile.Close()
-
-	contentPath := filepath.Join(tempDir, "OEBPS")
-
-	err = os.MkdirAll(contentPath, os.ModePerm)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func Setup_content(tempDir string, numb_of_chaps int, name string, author string, desc string, img_type string, imgDir []os.DirEntry) (error){
-	contentFilePath := filepath.Join(tempDir, "OEBPS", "content.opf")
-
-	contentFile, err := os.Create(contentFilePath)
-	
-	if err != nil {
-		return err
-	}
-
-	containerBytes, err := GenerateContentOPF(name, author, desc, numb_of_chaps, img_type, imgDir)
-  	if err != nil {
-    	return err
-  	}
-	contentFile.Write(containerBytes)
-	defer contentFile.Close()
-	return nil
-}
-
-func Setup_Nav(tempDir string, chapters []ChapterNavItem, Title string) (error) {
-	NavFilePath := filepath.Join(tempDir, "OEBPS", "nav.xhtml")
-	NavFile, err := os.Create(NavFilePath)
-	
-	if err != nil {
-		return err
-	}
-
-	NavString, err := GenerateNavXHTML(Title, chapters)
-
-	if err != nil {
-		return err
-	}
-
-	NavFile.WriteString(NavString)
-
-	return nil
-}
-
-
-func SetupToc(tempDir string, Title string, chap_list []ChapterNavItem) error {
-	TocFilePath, err := os.Create(filepath.Join(tempDir, "OEBPS", "toc.ncx"))
-
-	if err != nil {
-		return err
-	}
-
-
-	TocString, err := GenerateTOCNCX(Title, "quikmcbu", chap_list)
-
-	if err != nil {
-		return err
-	}
-
-	TocFilePath.Write(TocString)
-	TocFilePath.Close()
-	return nil
-}
-
-
-func createToc(w *zip.Writer, tempDir string) error {
-	f, err := w.Create("OEBPS/toc.ncx")
-    if err != nil {
-        return err
-    }
-    content, err := os.ReadFile(filepath.Join(tempDir, "OEBPS", "toc.ncx"))
-
-	if err != nil {
-		return err
-	}
-    _, err = f.Write(content)
-    if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func AddChapters(chap_body string, chap_index int, tempDir string, title string) (error) {
-	XHTMLPath := filepath.Join(tempDir, "OEBPS", fmt.Sprintf("chapter_%d.xhtml", chap_index))
-	XHTMLFile, err := os.Create(XHTMLPath)
-
-	if err != nil {
-		return err
-	}
-
-	XHMTLBytes, err := GenerateXHTML(title, chap_body)
-
-	if err != nil {
-		return err
-	}
-
-	XHTMLFile.Write(XHMTLBytes)
-	XHTMLFile.Close()
-
-	return nil
+func css_nav() string {
+	return "BODY {color: white;}"
 }
 
 func createMimetype(w *zip.Writer) error {
@@ -658,66 +602,6 @@ func createMimetype(w *zip.Writer) error {
     return err
 }
 
-func createContainerXML(w *zip.Writer, tempFile string) error {
-    f, err := w.Create("META-INF/container.xml")
-    if err != nil {
-        return err
-    }
-    content, err := os.ReadFile(tempFile)
-
-	if err != nil {
-		return err
-	}
-    _, err = f.Write(content)
-    if err != nil {
-		return err
-	}
-	return nil
-}
-
-func createContentOPF(w *zip.Writer, tempFile string) error {
-    f, err := w.Create("OEBPS/content.opf")
-    if err != nil {
-        return err
-    }
-	
-	content, err := os.ReadFile(tempFile)
-
-	if err != nil {
-		return err
-	}
-
-    _, err = f.Write(content)
-	if err != nil {
-		return err
-	}
-
-    return nil
-}
-
-func createMain(w *zip.Writer, tempDir string) error {
-	f, err := w.Create("style/main.css")
-
-	 if err != nil {
-        return err
-    }
-	
-	content, err := os.ReadFile(filepath.Join(tempDir, "style", "main.css"))
-
-	if err != nil {
-		return err
-	}
-
-    _, err = f.Write(content)
-	if err != nil {
-		return err
-	}
-
-
-	return nil
-}
-
-
 func getImageExt(mediaType string) string {
     switch mediaType {
     case "image/png":
@@ -728,179 +612,3 @@ func getImageExt(mediaType string) string {
         return "jpg" // fallback
     }
 }
-
-func AddCoverImage(zipWriter *zip.Writer, coverBytes []byte, mediaType string) error {
-    f, err := zipWriter.Create("cover." + getImageExt(mediaType))
-    if err != nil {
-        return err
-    }
-    _, err = f.Write(coverBytes)
-    return err
-}
-
-func createStyleNav(w *zip.Writer, tempDir string) error {
-	f, err := w.Create("style/nav.css")
-
-	 if err != nil {
-        return err
-    }
-	
-	content, err := os.ReadFile(filepath.Join(tempDir, "style", "nav.css"))
-
-	if err != nil {
-		return err
-	}
-
-    _, err = f.Write(content)
-	if err != nil {
-		return err
-	}
-
-
-	return nil
-}
-
-func createChapter(w *zip.Writer, tempDir string, tempFile string) error {
-    f, err := w.Create(filepath.Join("OEBPS", tempFile))
-    if err != nil {
-        return err
-    }
-    content, err := os.ReadFile(filepath.Join(tempDir, "OEBPS", tempFile))
-	if err != nil {
-		return err
-	}
-    _, err = f.Write(content)
-    
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func createNav(w *zip.Writer, tempDir string) (error) {
-	f, err := w.Create("OEBPS/nav.xhtml")
-	
-	if err != nil {
-		return err
-	}
-	
-	content, err := os.ReadFile(filepath.Join(tempDir, "OEBPS", "nav.xhtml"))
-	if err != nil {
-		return err
-	}
-    _, err = f.Write(content)
-    
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-
-
-func AddImages(w *zip.Writer, tempDir string) error {
-    imgDir := filepath.Join(tempDir, "images")
-    if _, err := os.Stat(imgDir); os.IsNotExist(err) {
-        return nil // nothing to do
-    }
-
-    entries, err := os.ReadDir(imgDir)
-    if err != nil {
-        return err
-    }
-
-    for _, i := range entries {
-        content, err := os.ReadFile(filepath.Join(imgDir, i.Name()))
-        if err != nil {
-            return err
-        }
-
-        f, err := w.Create(filepath.Join("images", i.Name()))
-        if err != nil {
-            return err
-        }
-
-        _, err = f.Write(content)
-        if err != nil {
-            return err
-        }
-    }
-
-    return nil
-}
-
-
-func Make_Ebook(tempDir string, filename string, img_bytes []byte, img_type string, anyImage bool) (error) {
-	epub, err := os.Create(filename)
-	
-	if err != nil {
-		return err
-	}
-
-	cont := filepath.Join(tempDir, "META-INF", "container.xml")
-	content := filepath.Join(tempDir, "OEBPS", "content.opf")
-	chapters, err := os.ReadDir(filepath.Join(tempDir, "OEBPS"), )
-
-	if err != nil {
-		return err
-	}
-
-    defer epub.Close()
-
-    zipWriter := zip.NewWriter(epub)
-    defer zipWriter.Close()
-
-    // para criar os arquivos do EPUB
-    if err := createMimetype(zipWriter); err != nil {
-        return err
-    }
-
-	if err := createContainerXML(zipWriter, cont); err != nil {
-		return err
-	}
-	
-
-	if err := createContentOPF(zipWriter, content); err != nil {
-		return err
-	}
-	for _, i := range chapters {
-		
-		if strings.HasSuffix(i.Name(), ".xhtml") && i.Name() != "nav.xhtml" {
-			err := createChapter(zipWriter, tempDir, i.Name())
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	if err := createMain(zipWriter, tempDir); err != nil {
-		return err
-	}
-
-	if err := createStyleNav(zipWriter, tempDir); err != nil {
-		return err
-	}
-	
-	if err := createNav(zipWriter, tempDir); err != nil {
-		return err
-	}
-
-	if err := createToc(zipWriter, tempDir); err != nil {
-		return err
-	}
-
-
-	if err := AddCoverImage(zipWriter, img_bytes, img_type); err != nil {
-		return err
-	}
-
-	if anyImage {
-	if err := AddImages(zipWriter, tempDir); err != nil {
-		return err
-	}
-	}
-	return nil
-
-}
\ No newline at end of file
@@ -0,0 +1,169 @@
+package ebook
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// The pages generated from the metadata, ahead of the first chapter. The
+// cover page is cover.xhtml, as the id cover is the image.
+const (
+	coverPageID    = "cover_page"
+	coverPageHref  = "cover.xhtml"
+	titlePageID    = "title_page"
+	introductionID = "introduction"
+)
+
+// frontMatter is the cover page when there is a cover, the title page
+// (cover, title, author, where the story came from and when it was
+// downloaded) and the introduction (description, tags, status and counts).
+// They are made when the book is written, so they show the metadata as it
+// is then, in the language of the story.
+func (b *Book) frontMatter() ([]document, error) {
+	labels := b.Labels()
+	type page struct {
+		id    string
+		href  string
+		title string
+		body  string
+	}
+	var pages []page
+	if len(b.cover) > 0 {
+		pages = append(pages, page{coverPageID, coverPageHref, labels.Cover, b.coverPage()})
+	}
+	pages = append(pages,
+		page{titlePageID, titlePageID + ".xhtml", labels.TitlePage, b.titlePage()},
+		page{introductionID, introductionID + ".xhtml", labels.Introduction, b.introduction()},
+	)
+
+	docs := make([]document, 0, len(pages))
+	for _, page := range pages {
+		xhtml, err := GenerateXHTML(page.title, b.Language(), page.body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", page.title, err)
+		}
+		if b.kepub {
+			if xhtml, err = kepubXHTML(xhtml); err != nil {
+				return nil, fmt.Errorf("%s: %w", page.title, err)
+			}
+		}
+		docs = append(docs, document{id: page.id, href: page.href, xhtml: xhtml})
+	}
+	return docs, nil
+}
+
+// frontNavItems are the entries of the front matter in the nav and NCX.
+func (b *Book) frontNavItems() []ChapterNavItem {
+	labels := b.Labels()
+	return []ChapterNavItem{
+		{Href: titlePageID + ".xhtml", Title: labels.TitlePage},
+		{Href: introductionID + ".xhtml", Title: labels.Introduction},
+	}
+}
+
+// landmarks are where readers open the book and the pages of its guide: the
+// cover, the title page, the table of contents and the first chapter.
+func (b *Book) landmarks() []Landmark {
+	labels := b.Labels()
+	var landmarks []Landmark
+	if len(b.cover) > 0 {
+		landmarks = append(landmarks, Landmark{Type: "cover", GuideType: "cover", Title: labels.Cover, Href: coverPageHref})
+	}
+	landmarks = append(landmarks,
+		Landmark{Type: "titlepage", GuideType: "title-page", Title: labels.TitlePage, Href: titlePageID + ".xhtml"},
+		Landmark{Type: "toc", GuideType: "toc", Title: labels.TableOfContents, Href: "nav.xhtml#toc"},
+	)
+	if toc := b.TOC(); len(toc) > 0 {
+		landmarks = append(landmarks, Landmark{Type: "bodymatter", GuideType: "text", Title: labels.StartOfContent, Href: toc[0].Href})
+	}
+	return landmarks
+}
+
+// coverPage shows nothing but the cover, for the readers that open on it.
+func (b *Book) coverPage() string {
+	return fmt.Sprintf(`<section epub:type="cover" class="cover"><img src="../%s" alt="%s"/></section>`, b.CoverName(), html.EscapeString(b.Metadata.Name))
+}
+
+func (b *Book) titlePage() string {
+	metadata := b.Metadata
+	labels := b.Labels()
+
+	var page strings.Builder
+	page.WriteString(`<section class="title-page" epub:type="titlepage">`)
+	if len(b.cover) > 0 {
+		fmt.Fprintf(&page, `<img src="../%s" alt="%s" width="100%%"/>`, b.CoverName(), html.EscapeString(metadata.Name))
+	}
+	fmt.Fprintf(&page, "<h1>%s</h1>", html.EscapeString(metadata.Name))
+	if metadata.Author != "" {
+		fmt.Fprintf(&page, "<p>%s</p>", html.EscapeString(labels.Byline(metadata.Author)))
+	}
+	if metadata.URL != "" {
+		url := html.EscapeString(metadata.URL)
+		fmt.Fprintf(&page, `<p class="source"><a href="%s">%s</a></p>`, url, url)
+	}
+	fmt.Fprintf(&page, `<p class="downloaded">%s</p>`, html.EscapeString(fmt.Sprintf(labels.Downloaded, labels.Date(b.created))))
+	page.WriteString("</section>")
+	return page.String()
+}
+
+func (b *Book) introduction() string {
+	metadata := b.Metadata
+
+	var page strings.Builder
+	page.WriteString(`<section class="introduction" epub:type="introduction" role="doc-introduction">`)
+	fmt.Fprintf(&page, "<h2>%s</h2>", html.EscapeString(b.Labels().Introduction))
+	for _, line := range strings.Split(strings.TrimSpace(metadata.Description), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			fmt.Fprintf(&page, "<p>%s</p>", html.EscapeString(line))
+		}
+	}
+
+	page.WriteString("<dl>")
+	for _, field := range b.Fields() {
+		fmt.Fprintf(&page, "<dt>%s</dt><dd>%s</dd>", html.EscapeString(field.Name), html.EscapeString(field.Value))
+	}
+	page.WriteString("</dl></section>")
+	return page.String()
+}
+
+// Field is one of the details of a story shown after its description.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Fields are the details of the story that have a value: its status,
+// language, tags, counts, rating and number of chapters, in the order the
+// introduction, the HTML page and the Word document list them, named in the
+// language of the story.
+func (b *Book) Fields() []Field {
+	metadata := b.Metadata
+	labels := b.Labels()
+
+	var fields []Field
+	field := func(name string, value string) {
+		if value != "" {
+			fields = append(fields, Field{name, value})
+		}
+	}
+	status := labels.Ongoing
+	if metadata.Completed {
+		status = labels.Completed
+	}
+	field(labels.Status, status)
+	field(labels.Language, metadata.Language)
+	field(labels.Tags, strings.Join(metadata.Tags, ", "))
+	if metadata.Reads > 0 {
+		field(labels.Reads, labels.Number(metadata.Reads))
+	}
+	if metadata.Votes > 0 {
+		field(labels.Votes, labels.Number(metadata.Votes))
+	}
+	if metadata.Mature {
+		field(labels.Rating, labels.Mature)
+	}
+	field(labels.Chapters, strconv.Itoa(len(b.chapters)))
+	return fields
+}
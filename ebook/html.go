@@ -0,0 +1,211 @@
+package ebook
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// WriteHTML writes the whole book as a single HTML page: the cover, a block
+// with the metadata, the table of contents linking to every chapter and the
+// chapters themselves, with the images as data: URIs and the stylesheet of
+// the EPUB inline, so the file can be opened in any browser on its own.
+func (b *Book) WriteHTML(w io.Writer) error {
+	if len(b.chapters) == 0 {
+		return errors.New("o livro não tem nenhum capítulo")
+	}
+
+	images := map[string]string{}
+	for _, img := range b.images {
+		images[img.Name] = dataURI(img.Data, img.MediaType)
+	}
+
+	out := bufio.NewWriter(w)
+	title := html.EscapeString(b.Metadata.Name)
+
+	fmt.Fprintf(out, "<!DOCTYPE html>\n<html lang=\"%s\">\n<head>\n<meta charset=\"utf-8\"/>\n", b.Language())
+	fmt.Fprintf(out, "<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\"/>\n<title>%s</title>\n", title)
+	fmt.Fprintf(out, "<style>%s%s</style>\n</head>\n<body>\n", css_main(), css_page())
+
+	if len(b.cover) > 0 {
+		fmt.Fprintf(out, "<img class=\"cover\" src=\"%s\" alt=\"%s\"/>\n", dataURI(b.cover, b.coverType), title)
+	}
+	b.writeMetadata(out)
+
+	fmt.Fprintf(out, "<nav id=\"toc\">\n<h2>%s</h2>\n", html.EscapeString(b.Labels().Contents))
+	writeHTMLNav(out, b.navItems())
+	out.WriteString("</nav>\n")
+
+	var write func(entries []Entry) error
+	write = func(entries []Entry) error {
+		for _, entry := range entries {
+			id := strings.TrimSuffix(entry.Href, path.Ext(entry.Href))
+			if entry.Section != nil {
+				body, err := inlineBody(sectionPage(*entry.Section, b.Labels()), images)
+				if err != nil {
+					return fmt.Errorf("%s: %w", entry.Title, err)
+				}
+				fmt.Fprintf(out, "<section id=\"%s\" class=\"story\">\n%s\n</section>\n", id, body)
+			} else {
+				body, err := inlineBody(entry.Chapter.Body, images)
+				if err != nil {
+					return fmt.Errorf("%s: %w", entry.Title, err)
+				}
+				fmt.Fprintf(out, "<section id=\"%s\" class=\"chapter\">\n<h2>%s</h2>\n%s\n</section>\n", id, html.EscapeString(entry.Title), body)
+			}
+			if err := write(entry.Children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := write(b.TOC()); err != nil {
+		return err
+	}
+
+	out.WriteString("</body>\n</html>\n")
+	return out.Flush()
+}
+
+// WriteHTMLFile writes the HTML page of the book to the file name.
+func (b *Book) WriteHTMLFile(name string) error {
+	return CreateFile(name, b.WriteHTML)
+}
+
+// writeMetadata writes the block with the title, author and the rest of the
+// story information that comes after the cover.
+func (b *Book) writeMetadata(out *bufio.Writer) {
+	metadata := b.Metadata
+
+	out.WriteString("<header class=\"metadata\">\n")
+	fmt.Fprintf(out, "<h1>%s</h1>\n", html.EscapeString(metadata.Name))
+	if metadata.Author != "" {
+		fmt.Fprintf(out, "<p class=\"author\">%s</p>\n", html.EscapeString(b.Labels().Byline(metadata.Author)))
+	}
+	if metadata.Description != "" {
+		description := strings.ReplaceAll(html.EscapeString(strings.TrimSpace(metadata.Description)), "\n", "<br/>")
+		fmt.Fprintf(out, "<p class=\"description\">%s</p>\n", description)
+	}
+
+	out.WriteString("<dl>\n")
+	for _, field := range b.Fields() {
+		fmt.Fprintf(out, "<dt>%s</dt><dd>%s</dd>\n", html.EscapeString(field.Name), html.EscapeString(field.Value))
+	}
+	out.WriteString("</dl>\n</header>\n")
+}
+
+// writeHTMLNav writes the nested list of the table of contents, linking to
+// the sections of the page instead of the files of the EPUB.
+func writeHTMLNav(out *bufio.Writer, items []ChapterNavItem) {
+	out.WriteString("<ol>\n")
+	for _, item := range items {
+		id := strings.TrimSuffix(item.Href, path.Ext(item.Href))
+		fmt.Fprintf(out, "<li><a href=\"#%s\">%s</a>", id, html.EscapeString(item.Title))
+		if len(item.Children) > 0 {
+			out.WriteString("\n")
+			writeHTMLNav(out, item.Children)
+		}
+		out.WriteString("</li>\n")
+	}
+	out.WriteString("</ol>\n")
+}
+
+// inlineBody points the images of a chapter body at their data: URIs and
+// links to other chapters at their section of the page.
+func inlineBody(body string, images map[string]string) (string, error) {
+	nodes, err := xhtml.ParseFragment(strings.NewReader(body), &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return "", err
+	}
+
+	var rewrite func(n *xhtml.Node)
+	rewrite = func(n *xhtml.Node) {
+		if n.Type == xhtml.ElementNode {
+			for i, attr := range n.Attr {
+				switch {
+				case n.DataAtom == atom.Img && attr.Key == "src":
+					if uri, ok := images[path.Base(attr.Val)]; ok {
+						n.Attr[i].Val = uri
+					}
+				case n.DataAtom == atom.A && attr.Key == "href":
+					if file, _, _ := strings.Cut(attr.Val, "#"); strings.HasSuffix(file, ".xhtml") && !strings.Contains(file, ":") {
+						n.Attr[i].Val = "#" + strings.TrimSuffix(path.Base(file), ".xhtml")
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			rewrite(c)
+		}
+	}
+
+	var out strings.Builder
+	for _, n := range nodes {
+		rewrite(n)
+		if err := xhtml.Render(&out, n); err != nil {
+			return "", err
+		}
+	}
+	return out.String(), nil
+}
+
+func dataURI(data []byte, mediaType string) string {
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// css_page is what the single page needs on top of css_main, since it has
+// no reading system to lay the chapters out.
+func css_page() string {
+	return `
+body {
+    max-width: 42em;
+    margin: 0 auto;
+    padding: 1em;
+    line-height: 1.5;
+}
+
+img {
+    max-width: 100%;
+    height: auto;
+}
+
+img.cover {
+    display: block;
+    margin: 0 auto 2em;
+    max-height: 90vh;
+}
+
+.metadata, .story {
+    text-align: center;
+}
+
+.metadata dl {
+    display: inline-grid;
+    grid-template-columns: auto auto;
+    gap: 0.2em 1em;
+    text-align: left;
+}
+
+.metadata dt {
+    font-weight: bold;
+}
+
+.metadata dd {
+    margin: 0;
+}
+
+section.chapter, section.story, #toc {
+    border-top: 1px solid #c7ccd1;
+    margin-top: 3em;
+    padding-top: 1em;
+}
+`
+}
@@ -0,0 +1,49 @@
+package ebook
+
+import (
+	"crypto/sha1"
+	"fmt"
+)
+
+// namespaceURL is the RFC 4122 namespace for names that are URLs or URNs.
+var namespaceURL = [16]byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// Identifier is the unique identifier of the book, used as dc:identifier and
+// dtb:uid. It is a UUIDv5 of SourceIdentifier, so downloading the same story
+// again gives the same value and readers keep the reading position.
+func (b *Book) Identifier() string {
+	name := b.SourceIdentifier()
+	if name == "" {
+		// sem id na fonte, o melhor que dá para fazer é título e autor
+		name = "urn:title:" + b.Metadata.Name + "\x00" + b.Metadata.Author
+	}
+	return "urn:uuid:" + uuidV5(namespaceURL, name)
+}
+
+// SourceIdentifier names the story on its site, like urn:wattpad:389173089.
+// It is empty when the source didn't give the story an id.
+func (b *Book) SourceIdentifier() string {
+	if b.Metadata.ID == "" {
+		return ""
+	}
+	source := b.Metadata.Source
+	if source == "" {
+		source = "story"
+	}
+	return fmt.Sprintf("urn:%s:%s", source, b.Metadata.ID)
+}
+
+// uuidV5 is the name based UUID from RFC 4122 section 4.3, using SHA-1.
+func uuidV5(namespace [16]byte, name string) string {
+	h := sha1.New()
+	h.Write(namespace[:])
+	h.Write([]byte(name))
+	sum := h.Sum(nil)
+
+	var u [16]byte
+	copy(u[:], sum)
+	u[6] = (u[6] & 0x0f) | 0x50 // versão 5
+	u[8] = (u[8] & 0x3f) | 0x80 // variante RFC 4122
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
@@ -0,0 +1,174 @@
+package ebook
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// koboStyle is what Kobo's own converter puts in the head of every page, so
+// the book-inner wrapper doesn't add margins of its own.
+const koboStyle = "div#book-inner { margin-top: 0; margin-bottom: 0; }"
+
+// blockTags start a new paragraph in the numbering of the kobo spans.
+var blockTags = map[string]bool{
+	"p": true, "div": true, "li": true, "blockquote": true, "pre": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"td": true, "th": true, "dt": true, "dd": true, "figcaption": true,
+}
+
+// sentenceEnd splits text after ., !, ?, or …, taking closing quotes and the
+// spaces after them along with the sentence.
+var sentenceEnd = regexp.MustCompile(`[.!?…]+['"’”)\]]*\s+`)
+
+// Kepub turns the XHTML of every page of the book into KEPUB markup, which
+// Kobo readers need for reading statistics and page turning: each sentence
+// and image goes in a <span class="koboSpan" id="kobo.P.S">, P counting the
+// paragraphs of the page and S the sentences of the paragraph, and the body
+// is wrapped in the book-columns and book-inner divs. Write the book with a
+// .kepub.epub name afterwards.
+func (b *Book) Kepub() error {
+	b.kepub = true
+	for i := range b.chapters {
+		xhtml, err := kepubXHTML(b.chapters[i].xhtml)
+		if err != nil {
+			return fmt.Errorf("%s: %w", b.chapters[i].Href, err)
+		}
+		b.chapters[i].xhtml = xhtml
+	}
+	for i := range b.sections {
+		xhtml, err := kepubXHTML(b.sections[i].xhtml)
+		if err != nil {
+			return fmt.Errorf("%s: %w", b.sections[i].Href, err)
+		}
+		b.sections[i].xhtml = xhtml
+	}
+	return nil
+}
+
+func kepubXHTML(page []byte) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(page); err != nil {
+		return nil, err
+	}
+
+	html := doc.Root()
+	head, body := html.SelectElement("head"), html.SelectElement("body")
+	if head == nil || body == nil {
+		return nil, fmt.Errorf("a página não tem head ou body")
+	}
+	// the page was already converted
+	if body.FindElement(`.//span[@class='koboSpan']`) != nil {
+		return page, nil
+	}
+
+	style := head.CreateElement("style")
+	style.CreateAttr("type", "text/css")
+	style.CreateAttr("id", "kobostylehacks")
+	style.SetText(koboStyle)
+
+	k := &koboSpans{}
+	k.wrap(body)
+
+	columns := etree.NewElement("div")
+	columns.CreateAttr("id", "book-columns")
+	inner := columns.CreateElement("div")
+	inner.CreateAttr("id", "book-inner")
+	for len(body.Child) > 0 {
+		inner.AddChild(body.Child[0])
+	}
+	body.AddChild(columns)
+
+	// quotes in the text stay as they were
+	doc.WriteSettings.CanonicalText = true
+	return doc.WriteToBytes()
+}
+
+// koboSpans numbers the spans of a page.
+type koboSpans struct {
+	paragraph int
+	sentence  int
+	// newParagraph is set when a block starts or ends, so the next span
+	// starts a paragraph
+	newParagraph bool
+}
+
+func (k *koboSpans) span() *etree.Element {
+	if k.newParagraph || k.paragraph == 0 {
+		k.paragraph++
+		k.sentence = 0
+		k.newParagraph = false
+	}
+	k.sentence++
+
+	span := etree.NewElement("span")
+	span.CreateAttr("class", "koboSpan")
+	span.CreateAttr("id", fmt.Sprintf("kobo.%d.%d", k.paragraph, k.sentence))
+	return span
+}
+
+// wrap puts the text and images under e in kobo spans.
+func (k *koboSpans) wrap(e *etree.Element) {
+	for _, token := range append([]etree.Token(nil), e.Child...) {
+		e.RemoveChild(token)
+
+		switch t := token.(type) {
+		case *etree.CharData:
+			if t.IsWhitespace() {
+				e.AddChild(t)
+				continue
+			}
+			// the spaces around the text are only formatting, so they stay out of the spans
+			text := strings.TrimSpace(t.Data)
+			start := strings.Index(t.Data, text)
+			lead, trail := t.Data[:start], t.Data[start+len(text):]
+			if lead != "" {
+				e.AddChild(etree.NewText(lead))
+			}
+			for _, sentence := range sentences(text) {
+				span := k.span()
+				span.SetText(sentence)
+				e.AddChild(span)
+			}
+			if trail != "" {
+				e.AddChild(etree.NewText(trail))
+			}
+
+		case *etree.Element:
+			switch {
+			case t.Tag == "script" || t.Tag == "style" || t.Tag == "svg" || t.Tag == "math":
+			case t.Tag == "img":
+				span := k.span()
+				span.AddChild(t)
+				e.AddChild(span)
+				continue
+			case blockTags[t.Tag]:
+				k.newParagraph = true
+				k.wrap(t)
+				k.newParagraph = true
+			default:
+				k.wrap(t)
+			}
+			e.AddChild(t)
+
+		default:
+			e.AddChild(token)
+		}
+	}
+}
+
+// sentences splits text into sentences, keeping every character.
+func sentences(text string) []string {
+	var parts []string
+	start := 0
+	for _, end := range sentenceEnd.FindAllStringIndex(text, -1) {
+		parts = append(parts, text[start:end[1]])
+		start = end[1]
+	}
+	if start < len(text) {
+		parts = append(parts, text[start:])
+	}
+	return parts
+}
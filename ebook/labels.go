@@ -0,0 +1,148 @@
+package ebook
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Labels are the words of the pages a book makes up itself, like the title
+// page and the introduction, in the language of the story.
+type Labels struct {
+	Cover           string
+	TitlePage       string
+	Introduction    string
+	Contents        string
+	TableOfContents string
+	StartOfContent  string
+	// By and Downloaded take the author and the date
+	By         string
+	Downloaded string
+
+	Status    string
+	Ongoing   string
+	Completed string
+	Language  string
+	Tags      string
+	Reads     string
+	Votes     string
+	Rating    string
+	Mature    string
+	Chapters  string
+
+	// date takes the day, the name of the month and the year, in that order
+	date      string
+	months    [12]string
+	thousands string
+}
+
+// labels has the languages the generated pages are translated to. Stories
+// in any other language get English ones.
+var labels = map[string]Labels{
+	"en": {
+		Cover: "Cover", TitlePage: "Title Page", Introduction: "Introduction",
+		Contents: "Contents", TableOfContents: "Table of Contents", StartOfContent: "Start of Content",
+		By: "by %s", Downloaded: "Downloaded on %s",
+		Status: "Status", Ongoing: "Ongoing", Completed: "Completed", Language: "Language", Tags: "Tags",
+		Reads: "Reads", Votes: "Votes", Rating: "Rating", Mature: "Mature", Chapters: "Chapters",
+		date: "%[2]s %[1]d, %[3]d",
+		months: [12]string{"January", "February", "March", "April", "May", "June",
+			"July", "August", "September", "October", "November", "December"},
+		thousands: ",",
+	},
+	"pt": {
+		Cover: "Capa", TitlePage: "Folha de rosto", Introduction: "Introdução",
+		Contents: "Sumário", TableOfContents: "Sumário", StartOfContent: "Início do conteúdo",
+		By: "por %s", Downloaded: "Baixado em %s",
+		Status: "Situação", Ongoing: "Em andamento", Completed: "Completa", Language: "Idioma", Tags: "Tags",
+		Reads: "Leituras", Votes: "Votos", Rating: "Classificação", Mature: "Adulto", Chapters: "Capítulos",
+		date: "%[1]d de %[2]s de %[3]d",
+		months: [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho",
+			"julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		thousands: ".",
+	},
+	"es": {
+		Cover: "Portada", TitlePage: "Portadilla", Introduction: "Introducción",
+		Contents: "Contenido", TableOfContents: "Índice", StartOfContent: "Inicio del contenido",
+		By: "por %s", Downloaded: "Descargado el %s",
+		Status: "Estado", Ongoing: "En curso", Completed: "Completa", Language: "Idioma", Tags: "Etiquetas",
+		Reads: "Lecturas", Votes: "Votos", Rating: "Clasificación", Mature: "Adulto", Chapters: "Capítulos",
+		date: "%[1]d de %[2]s de %[3]d",
+		months: [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio",
+			"julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		thousands: ".",
+	},
+	"fr": {
+		Cover: "Couverture", TitlePage: "Page de titre", Introduction: "Introduction",
+		Contents: "Sommaire", TableOfContents: "Table des matières", StartOfContent: "Début du contenu",
+		By: "par %s", Downloaded: "Téléchargé le %s",
+		Status: "Statut", Ongoing: "En cours", Completed: "Terminée", Language: "Langue", Tags: "Tags",
+		Reads: "Lectures", Votes: "Votes", Rating: "Classification", Mature: "Adulte", Chapters: "Chapitres",
+		date: "%[1]d %[2]s %[3]d",
+		months: [12]string{"janvier", "février", "mars", "avril", "mai", "juin",
+			"juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		// a no-break space, which the PDF fonts have, unlike the narrow one
+		thousands: "\u00a0",
+	},
+	"it": {
+		Cover: "Copertina", TitlePage: "Frontespizio", Introduction: "Introduzione",
+		Contents: "Indice", TableOfContents: "Indice", StartOfContent: "Inizio del contenuto",
+		By: "di %s", Downloaded: "Scaricato il %s",
+		Status: "Stato", Ongoing: "In corso", Completed: "Completata", Language: "Lingua", Tags: "Tag",
+		Reads: "Letture", Votes: "Voti", Rating: "Classificazione", Mature: "Per adulti", Chapters: "Capitoli",
+		date: "%[1]d %[2]s %[3]d",
+		months: [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno",
+			"luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		thousands: ".",
+	},
+	"de": {
+		Cover: "Titelbild", TitlePage: "Titelseite", Introduction: "Einleitung",
+		Contents: "Inhalt", TableOfContents: "Inhaltsverzeichnis", StartOfContent: "Beginn des Inhalts",
+		By: "von %s", Downloaded: "Heruntergeladen am %s",
+		Status: "Status", Ongoing: "Laufend", Completed: "Abgeschlossen", Language: "Sprache", Tags: "Tags",
+		Reads: "Aufrufe", Votes: "Stimmen", Rating: "Einstufung", Mature: "Erwachsene", Chapters: "Kapitel",
+		date: "%[1]d. %[2]s %[3]d",
+		months: [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni",
+			"Juli", "August", "September", "Oktober", "November", "Dezember"},
+		thousands: ".",
+	},
+}
+
+// Labels are the words of the generated pages in the language of the story,
+// or in English when it isn't translated. Regional codes like pt-BR use the
+// labels of their language.
+func (b *Book) Labels() Labels {
+	code := b.Language()
+	if l, ok := labels[code]; ok {
+		return l
+	}
+	if l, ok := labels[strings.ToLower(strings.SplitN(code, "-", 2)[0])]; ok {
+		return l
+	}
+	return labels["en"]
+}
+
+// Byline is "by author" in the language of the labels.
+func (l Labels) Byline(author string) string {
+	return fmt.Sprintf(l.By, author)
+}
+
+// Date writes t the way the language writes dates, like January 2, 2006.
+func (l Labels) Date(t time.Time) string {
+	return fmt.Sprintf(l.date, t.Day(), l.months[t.Month()-1], t.Year())
+}
+
+// Number writes n with the separator of the language between the groups of
+// digits, like 15,230.
+func (l Labels) Number(n int) string {
+	digits := strconv.Itoa(n)
+	var out strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out.WriteString(l.thousands)
+		}
+		out.WriteRune(d)
+	}
+	return out.String()
+}
@@ -0,0 +1,84 @@
+package ebook
+
+import (
+	"regexp"
+	"strings"
+)
+
+// languages lists the BCP 47 code of each language with the names sources
+// report for it, in English and in the language itself the way Wattpad
+// lists them.
+var languages = [][]string{
+	{"en", "english"},
+	{"fr", "french", "français"},
+	{"it", "italian", "italiano"},
+	{"de", "german", "deutsch"},
+	{"es", "spanish", "español"},
+	{"pt", "portuguese", "português"},
+	{"ca", "catalan", "català"},
+	{"tl", "tagalog"},
+	{"fil", "filipino"},
+	{"id", "indonesian", "bahasa indonesia"},
+	{"ms", "malay", "bahasa melayu"},
+	{"ru", "russian", "русский"},
+	{"ro", "romanian", "română"},
+	{"tr", "turkish", "türkçe"},
+	{"zh", "chinese", "中文"},
+	{"zh-Hans", "简体中文"},
+	{"zh-Hant", "繁體中文"},
+	{"ja", "japanese", "日本語"},
+	{"ko", "korean", "한국어"},
+	{"ar", "arabic", "العربية"},
+	{"vi", "vietnamese", "tiếng việt"},
+	{"th", "thai", "ภาษาไทย"},
+	{"pl", "polish", "polski"},
+	{"cs", "czech", "čeština"},
+	{"hu", "hungarian", "magyar"},
+	{"sv", "swedish", "svenska"},
+	{"no", "norwegian", "norsk"},
+	{"da", "danish", "dansk"},
+	{"fi", "finnish", "suomi"},
+	{"nl", "dutch", "nederlands"},
+	{"el", "greek", "ελληνικά"},
+	{"he", "hebrew", "עברית"},
+	{"hi", "hindi", "हिन्दी"},
+	{"fa", "persian", "فارسی"},
+	{"uk", "ukrainian", "українська"},
+	{"bn", "bengali", "বাংলা"},
+	{"ur", "urdu", "اردو"},
+	{"gu", "gujarati", "ગુજરાતી"},
+	{"ta", "tamil", "தமிழ்"},
+	{"sr", "serbian", "srpski"},
+	{"hr", "croatian", "hrvatski"},
+	{"sk", "slovak", "slovenčina"},
+	{"bg", "bulgarian", "български"},
+	{"lt", "lithuanian", "lietuvių"},
+	{"et", "estonian", "eesti"},
+	{"lv", "latvian", "latviešu"},
+}
+
+// languageTag matches names that already are a BCP 47 code, like pt or pt-BR.
+var languageTag = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// LanguageCode turns a language name like "English" or "Português" into the
+// code used by dc:language and lang attributes. Names it doesn't know give
+// "en", which is what most stories are written in.
+func LanguageCode(name string) string {
+	name = strings.TrimSpace(name)
+	for _, language := range languages {
+		for _, known := range language[1:] {
+			if strings.EqualFold(name, known) {
+				return language[0]
+			}
+		}
+	}
+	if languageTag.MatchString(name) {
+		return name
+	}
+	return "en"
+}
+
+// Language is the code of the language of the story.
+func (b *Book) Language() string {
+	return LanguageCode(b.Metadata.Language)
+}
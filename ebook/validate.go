@@ -0,0 +1,456 @@
+package ebook
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+const (
+	SeverityError   = "ERROR"
+	SeverityWarning = "WARNING"
+)
+
+// Finding is a single problem found by Validate. The codes follow the ones
+// epubcheck uses for the same problem, so they can be searched for.
+type Finding struct {
+	Severity string
+	Code     string
+	// Path is the file inside the epub the finding is about, empty for the book itself.
+	Path    string
+	Message string
+}
+
+// Format prints the finding like epubcheck does, e.g.
+// ERROR(RSC-001): book.epub/OEBPS/content.opf: File "images/a.png" could not be found
+func (f Finding) Format(epubName string) string {
+	location := epubName
+	if f.Path != "" {
+		location += "/" + f.Path
+	}
+	return fmt.Sprintf("%s(%s): %s: %s", f.Severity, f.Code, location, f.Message)
+}
+
+// Validate opens the epub at epubPath and checks its structure: the mimetype
+// entry, container.xml, the package document, that every manifest, spine,
+// nav and NCX reference resolves, unique ids and well-formed XHTML.
+// The error is only for epubs that can't be read at all.
+func Validate(epubPath string) ([]Finding, error) {
+	r, err := zip.OpenReader(epubPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ValidateZip(&r.Reader), nil
+}
+
+// ValidateZip is Validate for an epub that is already open.
+func ValidateZip(r *zip.Reader) []Finding {
+	v := &validator{files: map[string]*zip.File{}}
+	for _, f := range r.File {
+		v.files[f.Name] = f
+	}
+
+	v.checkMimetype(r.File)
+	opfPath := v.checkContainer()
+	if opfPath != "" {
+		v.checkPackage(opfPath)
+	}
+	return v.findings
+}
+
+type validator struct {
+	files    map[string]*zip.File
+	findings []Finding
+}
+
+func (v *validator) errorf(code string, file string, format string, args ...any) {
+	v.findings = append(v.findings, Finding{Severity: SeverityError, Code: code, Path: file, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(code string, file string, format string, args ...any) {
+	v.findings = append(v.findings, Finding{Severity: SeverityWarning, Code: code, Path: file, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) read(name string) ([]byte, error) {
+	f, ok := v.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (v *validator) checkMimetype(entries []*zip.File) {
+	if len(entries) == 0 || entries[0].Name != "mimetype" {
+		v.errorf("PKG-006", "", "Mimetype file entry is missing or is not the first file in the archive")
+		if _, ok := v.files["mimetype"]; !ok {
+			return
+		}
+	}
+
+	f := v.files["mimetype"]
+	if f.Method != zip.Store {
+		v.errorf("PKG-007", "mimetype", "Mimetype file should not be compressed")
+	}
+	if len(f.Extra) > 0 {
+		v.warnf("PKG-005", "mimetype", "The mimetype file has an extra field of length %d", len(f.Extra))
+	}
+
+	content, err := v.read("mimetype")
+	if err != nil {
+		v.errorf("PKG-008", "mimetype", "Unable to read file: %v", err)
+		return
+	}
+	if string(content) != "application/epub+zip" {
+		v.errorf("PKG-007", "mimetype", "Mimetype file should only contain the string \"application/epub+zip\", found %q", content)
+	}
+}
+
+type containerDoc struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// checkContainer returns the path of the package document, or "" when there isn't a usable one.
+func (v *validator) checkContainer() string {
+	const name = "META-INF/container.xml"
+
+	content, err := v.read(name)
+	if err != nil {
+		v.errorf("RSC-002", "", "Required file %s was not found in the container", name)
+		return ""
+	}
+
+	var container containerDoc
+	if err := xml.Unmarshal(content, &container); err != nil {
+		v.errorf("RSC-016", name, "Fatal Error while parsing file: %v", err)
+		return ""
+	}
+
+	for _, rootfile := range container.Rootfiles {
+		if rootfile.MediaType != "application/oebps-package+xml" {
+			continue
+		}
+		if _, ok := v.files[rootfile.FullPath]; !ok {
+			v.errorf("OPF-002", name, "The OPF file %q was not found in the EPUB container", rootfile.FullPath)
+			return ""
+		}
+		return rootfile.FullPath
+	}
+
+	v.errorf("RSC-003", name, "No rootfile tag with media type \"application/oebps-package+xml\" was found in the container")
+	return ""
+}
+
+type packageDoc struct {
+	Items []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc      string `xml:"toc,attr"`
+		Itemrefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+	Guide []struct {
+		Href string `xml:"href,attr"`
+	} `xml:"guide>reference"`
+}
+
+type manifestItem struct {
+	id        string
+	path      string
+	mediaType string
+}
+
+func (v *validator) checkPackage(opfPath string) {
+	content, err := v.read(opfPath)
+	if err != nil {
+		v.errorf("PKG-008", opfPath, "Unable to read file: %v", err)
+		return
+	}
+
+	v.checkWellFormed(opfPath, content)
+
+	var pkg packageDoc
+	if err := xml.Unmarshal(content, &pkg); err != nil {
+		return
+	}
+
+	var listed []manifestItem
+	items := map[string]manifestItem{}
+	declared := map[string]bool{opfPath: true, "mimetype": true}
+	var navPath string
+
+	for _, item := range pkg.Items {
+		// repeated ids are reported by checkWellFormed, like in every other document
+		if item.ID == "" {
+			v.errorf("RSC-005", opfPath, "Manifest item %q has no id", item.Href)
+		}
+
+		target, ok := resolve(opfPath, item.Href)
+		if !ok {
+			v.errorf("RSC-026", opfPath, "URL %q leaves the EPUB container", item.Href)
+			continue
+		}
+		listed = append(listed, manifestItem{id: item.ID, path: target, mediaType: item.MediaType})
+		if _, dup := items[item.ID]; !dup {
+			items[item.ID] = listed[len(listed)-1]
+		}
+		declared[target] = true
+
+		if _, ok := v.files[target]; !ok {
+			v.errorf("RSC-001", opfPath, "File %q could not be found", target)
+			continue
+		}
+
+		v.checkMediaType(opfPath, target, item.MediaType)
+
+		if hasProperty(item.Properties, "nav") {
+			if navPath != "" {
+				v.errorf("RSC-005", opfPath, "Exactly one manifest item must declare the \"nav\" property")
+			}
+			navPath = target
+		}
+	}
+
+	if len(pkg.Spine.Itemrefs) == 0 {
+		v.errorf("RSC-005", opfPath, "The spine has no itemref")
+	}
+	for _, ref := range pkg.Spine.Itemrefs {
+		if _, ok := items[ref.IDRef]; !ok {
+			v.errorf("OPF-049", opfPath, "Item id %q was not found in the manifest", ref.IDRef)
+		}
+	}
+
+	for _, ref := range pkg.Guide {
+		v.checkReference(opfPath, ref.Href)
+	}
+
+	for _, item := range listed {
+		if item.mediaType == "application/xhtml+xml" {
+			if content, err := v.read(item.path); err == nil {
+				v.checkWellFormed(item.path, content)
+			}
+		}
+	}
+
+	if navPath == "" {
+		v.errorf("RSC-005", opfPath, "Exactly one manifest item must declare the \"nav\" property")
+	} else {
+		v.checkNav(navPath)
+	}
+
+	if pkg.Spine.Toc != "" {
+		ncx, ok := items[pkg.Spine.Toc]
+		if !ok {
+			v.errorf("OPF-049", opfPath, "The spine toc %q was not found in the manifest", pkg.Spine.Toc)
+		} else if _, found := v.files[ncx.path]; found {
+			v.checkNCX(ncx.path)
+		}
+	}
+
+	names := make([]string, 0, len(v.files))
+	for name := range v.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !declared[name] && !strings.HasPrefix(name, "META-INF/") && !strings.HasSuffix(name, "/") {
+			v.warnf("OPF-003", name, "Item %q exists in the EPUB, but is not declared in the OPF manifest", name)
+		}
+	}
+}
+
+// checkMediaType compares the declared media type with the file extension
+// and, for images, with what the content looks like.
+func (v *validator) checkMediaType(opfPath string, target string, declared string) {
+	if declared == "" {
+		v.errorf("OPF-029", opfPath, "Manifest item %q has no media-type", target)
+		return
+	}
+
+	if strings.HasPrefix(declared, "image/") {
+		content, err := v.read(target)
+		if err != nil {
+			return
+		}
+		if detected := mimetype.Detect(content); !detected.Is(declared) {
+			v.errorf("OPF-029", opfPath, "The file %q does not appear to match the media type %q, it looks like %q", target, declared, detected.String())
+		}
+		return
+	}
+
+	byExt := mime.TypeByExtension(path.Ext(target))
+	if byExt != "" && !strings.HasPrefix(byExt, declared) && declared != "application/xhtml+xml" {
+		v.warnf("OPF-029", opfPath, "The file %q is declared as %q, but its extension suggests %q", target, declared, byExt)
+	}
+}
+
+// checkWellFormed parses an XML document and reports the first syntax error
+// and repeated id attributes.
+func (v *validator) checkWellFormed(name string, content []byte) {
+	dec := xml.NewDecoder(bytes.NewReader(content))
+	dec.Strict = true
+
+	ids := map[string]bool{}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			v.errorf("RSC-016", name, "Fatal Error while parsing file: %v", err)
+			return
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range start.Attr {
+			if attr.Name.Local != "id" || (attr.Name.Space != "" && attr.Name.Space != "xml") {
+				continue
+			}
+			if ids[attr.Value] {
+				v.errorf("RSC-005", name, "Duplicate ID %q", attr.Value)
+			}
+			ids[attr.Value] = true
+		}
+	}
+}
+
+// checkNav makes sure every link of the nav document points at a file in the epub.
+func (v *validator) checkNav(navPath string) {
+	content, err := v.read(navPath)
+	if err != nil {
+		return
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(content))
+	hasToc := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "nav":
+			if attrValue(start, "type") == "toc" {
+				hasToc = true
+			}
+		case "a":
+			v.checkReference(navPath, attrValue(start, "href"))
+		}
+	}
+
+	if !hasToc {
+		v.errorf("RSC-005", navPath, "The nav document has no nav element with epub:type=\"toc\"")
+	}
+}
+
+type ncxDoc struct {
+	Points []ncxPoint `xml:"navMap>navPoint"`
+}
+
+type ncxPoint struct {
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Children []ncxPoint `xml:"navPoint"`
+}
+
+func (v *validator) checkNCX(ncxPath string) {
+	content, err := v.read(ncxPath)
+	if err != nil {
+		return
+	}
+
+	v.checkWellFormed(ncxPath, content)
+
+	var ncx ncxDoc
+	if err := xml.Unmarshal(content, &ncx); err != nil {
+		return
+	}
+
+	var walk func(points []ncxPoint)
+	walk = func(points []ncxPoint) {
+		for _, point := range points {
+			v.checkReference(ncxPath, point.Content.Src)
+			walk(point.Children)
+		}
+	}
+	walk(ncx.Points)
+}
+
+func (v *validator) checkReference(from string, href string) {
+	if href == "" || strings.Contains(href, "://") || strings.HasPrefix(href, "mailto:") {
+		return
+	}
+
+	target, _, _ := strings.Cut(href, "#")
+	if target == "" {
+		return
+	}
+
+	resolved, ok := resolve(from, target)
+	if !ok {
+		v.errorf("RSC-026", from, "URL %q leaves the EPUB container", href)
+		return
+	}
+	if _, found := v.files[resolved]; !found {
+		v.errorf("RSC-007", from, "Referenced resource %q could not be found in the EPUB", resolved)
+	}
+}
+
+// resolve turns href, relative to the file from, into a path inside the zip.
+// It reports false when the href climbs out of the container.
+func resolve(from string, href string) (string, bool) {
+	joined := path.Join(path.Dir(from), href)
+	if joined == ".." || strings.HasPrefix(joined, "../") {
+		return "", false
+	}
+	return joined, true
+}
+
+func hasProperty(properties string, want string) bool {
+	for _, p := range strings.Fields(properties) {
+		if p == want {
+			return true
+		}
+	}
+	return false
+}
+
+func attrValue(start xml.StartElement, local string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,302 @@
+// Package fb2 writes a book as FictionBook 2, the XML format of readers like
+// FBReader and CoolReader: the story metadata goes in the title-info, every
+// chapter is a <section> with its title, and the cover and images are
+// base64 <binary> elements at the end of the file.
+package fb2
+
+import (
+	"archive/zip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+	"wattpad-to-ebook/document"
+	"wattpad-to-ebook/ebook"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	fb2Namespace   = "http://www.gribuser.ru/xml/fictionbook/2.0"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+	// genre is required by the format, and stories don't map to its list
+	genre = "prose_contemporary"
+)
+
+// Write writes the FB2 document of book to w.
+func Write(w io.Writer, book *ebook.Book) error {
+	doc, err := build(book)
+	if err != nil {
+		return err
+	}
+	_, err = doc.WriteTo(w)
+	return err
+}
+
+// WriteZip writes book to w as a zip holding a single FB2 file called name,
+// which readers open like the plain file.
+func WriteZip(w io.Writer, book *ebook.Book, name string) error {
+	archive := zip.NewWriter(w)
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, book); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// WriteFile writes book to the file name, zipped when zipped is set.
+func WriteFile(name string, book *ebook.Book, zipped bool) error {
+	return ebook.CreateFile(name, func(w io.Writer) error {
+		if zipped {
+			return WriteZip(w, book, entryName(name))
+		}
+		return Write(w, book)
+	})
+}
+
+// entryName is the name of the FB2 file inside the zip called name.
+func entryName(name string) string {
+	name = strings.TrimSuffix(filepath.Base(name), ".zip")
+	if !strings.HasSuffix(name, ".fb2") {
+		name += ".fb2"
+	}
+	return name
+}
+
+func build(book *ebook.Book) (*etree.Document, error) {
+	if len(book.Chapters()) == 0 {
+		return nil, errors.New("o livro não tem nenhum capítulo")
+	}
+
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	root := doc.CreateElement("FictionBook")
+	root.CreateAttr("xmlns", fb2Namespace)
+	root.CreateAttr("xmlns:l", xlinkNamespace)
+
+	images := map[string]ebook.Image{}
+	for _, img := range book.Images() {
+		images[img.Name] = img
+	}
+	b := &builder{images: images, used: map[string]bool{}, labels: book.Labels()}
+
+	description(root.CreateElement("description"), book, b)
+
+	body := root.CreateElement("body")
+	title := body.CreateElement("title")
+	title.CreateElement("p").SetText(book.Metadata.Name)
+	if book.Metadata.Author != "" {
+		title.CreateElement("p").SetText(book.Metadata.Author)
+	}
+	for _, entry := range book.TOC() {
+		if err := b.section(body, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if cover, coverType := book.Cover(); cover != nil {
+		binary(root, book.CoverName(), coverType, cover)
+	}
+	for _, img := range book.Images() {
+		if b.used[img.Name] {
+			binary(root, img.Name, img.MediaType, img.Data)
+		}
+	}
+
+	// indenting would add whitespace to the text of the paragraphs, so their
+	// runs only go in once the rest of the tree is indented
+	doc.Indent(1)
+	for _, p := range b.paragraphs {
+		paragraph(p.element, p.runs)
+	}
+	return doc, nil
+}
+
+// description fills the title-info with the story metadata and the
+// document-info with where the file came from.
+func description(desc *etree.Element, book *ebook.Book, b *builder) {
+	metadata := book.Metadata
+
+	info := desc.CreateElement("title-info")
+	info.CreateElement("genre").SetText(genre)
+	author := info.CreateElement("author")
+	author.CreateElement("nickname").SetText(metadata.Author)
+	info.CreateElement("book-title").SetText(metadata.Name)
+
+	if text := strings.TrimSpace(metadata.Description); text != "" {
+		annotation := info.CreateElement("annotation")
+		for _, line := range strings.Split(text, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				annotation.CreateElement("p").SetText(line)
+			}
+		}
+	}
+	if len(metadata.Tags) > 0 {
+		info.CreateElement("keywords").SetText(strings.Join(metadata.Tags, ", "))
+	}
+	if cover, _ := book.Cover(); cover != nil {
+		image := info.CreateElement("coverpage").CreateElement("image")
+		image.CreateAttr("l:href", "#"+book.CoverName())
+	}
+	info.CreateElement("lang").SetText(book.Language())
+
+	docInfo := desc.CreateElement("document-info")
+	docInfo.CreateElement("author").CreateElement("nickname").SetText("wattpad-to-ebook")
+	docInfo.CreateElement("program-used").SetText("wattpad-to-ebook")
+	now := time.Now().UTC()
+	date := docInfo.CreateElement("date")
+	date.CreateAttr("value", now.Format("2006-01-02"))
+	date.SetText(now.Format("2006-01-02"))
+	docInfo.CreateElement("id").SetText(strings.TrimPrefix(book.Identifier(), "urn:uuid:"))
+	docInfo.CreateElement("version").SetText("1.0")
+}
+
+func binary(root *etree.Element, id string, mediaType string, data []byte) {
+	bin := root.CreateElement("binary")
+	bin.CreateAttr("id", id)
+	bin.CreateAttr("content-type", mediaType)
+	bin.SetText(base64.StdEncoding.EncodeToString(data))
+}
+
+// builder turns chapters into sections and keeps track of the images they
+// use, which are the only ones embedded.
+type builder struct {
+	images     map[string]ebook.Image
+	used       map[string]bool
+	paragraphs []pending
+	labels     ebook.Labels
+}
+
+// pending is a paragraph waiting for its runs.
+type pending struct {
+	element *etree.Element
+	runs    []document.Run
+}
+
+// section adds a chapter, or a story of an omnibus with its chapters nested
+// in it, to parent. A section holding other sections can only have a title,
+// an image and an annotation before them, in that order, so the cover of a
+// story goes right after its title and the author in the annotation.
+func (b *builder) section(parent *etree.Element, entry ebook.Entry) error {
+	section := parent.CreateElement("section")
+	section.CreateElement("title").CreateElement("p").SetText(entry.Title)
+
+	if entry.Section != nil {
+		if entry.Section.Cover != "" {
+			b.image(section, entry.Section.Cover)
+		}
+		if entry.Section.Author != "" {
+			section.CreateElement("annotation").CreateElement("p").SetText(b.labels.Byline(entry.Section.Author))
+		}
+		for _, child := range entry.Children {
+			if err := b.section(section, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	blocks, err := document.Parse(entry.Chapter.Body)
+	if err != nil {
+		return fmt.Errorf("capítulo '%s': %w", entry.Title, err)
+	}
+	for _, block := range blocks {
+		b.block(section, block)
+	}
+
+	// a section can't be left with just a title
+	if len(section.ChildElements()) == 1 {
+		section.CreateElement("empty-line")
+	}
+	return nil
+}
+
+func (b *builder) block(section *etree.Element, block document.Block) {
+	switch block.Kind {
+	case document.Image:
+		b.image(section, block.Image)
+
+	case document.Rule:
+		section.CreateElement("subtitle").SetText("* * *")
+
+	case document.Heading:
+		section.CreateElement("subtitle").SetText(block.Text())
+
+	case document.Quote:
+		cite := section.CreateElement("cite")
+		for _, line := range lines(block.Runs) {
+			b.paragraph(cite, line)
+		}
+
+	case document.Preformatted:
+		for _, line := range strings.Split(block.Text(), "\n") {
+			section.CreateElement("p").CreateElement("code").SetText(line)
+		}
+
+	default:
+		// FB2 has no line breaks inside a paragraph
+		for _, line := range lines(block.Runs) {
+			b.paragraph(section, line)
+		}
+	}
+}
+
+// image adds the image called name, when the book has it.
+func (b *builder) image(section *etree.Element, name string) {
+	if _, ok := b.images[name]; !ok {
+		return
+	}
+	b.used[name] = true
+	section.CreateElement("image").CreateAttr("l:href", "#"+name)
+}
+
+// paragraph adds a <p> to parent, filled with runs by build.
+func (b *builder) paragraph(parent *etree.Element, runs []document.Run) {
+	b.paragraphs = append(b.paragraphs, pending{parent.CreateElement("p"), runs})
+}
+
+// lines splits runs at the line breaks.
+func lines(runs []document.Run) [][]document.Run {
+	result := [][]document.Run{nil}
+	for _, run := range runs {
+		for i, text := range strings.Split(run.Text, "\n") {
+			if i > 0 {
+				result = append(result, nil)
+			}
+			if text != "" {
+				piece := run
+				piece.Text = text
+				result[len(result)-1] = append(result[len(result)-1], piece)
+			}
+		}
+	}
+	return result
+}
+
+// paragraph fills p with runs, styled with strong, emphasis and links.
+func paragraph(p *etree.Element, runs []document.Run) {
+	for _, run := range runs {
+		parent := p
+		if run.Link != "" {
+			parent = parent.CreateElement("a")
+			parent.CreateAttr("l:href", run.Link)
+		}
+		if run.Bold {
+			parent = parent.CreateElement("strong")
+		}
+		if run.Italic {
+			parent = parent.CreateElement("emphasis")
+		}
+		if parent == p {
+			p.CreateText(run.Text)
+		} else {
+			parent.SetText(run.Text)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Package fetch is the HTTP client every download goes through. It adds
+// timeouts, retries with exponential backoff on 429 and 5xx answers, and a
+// global requests-per-second limit shared by all goroutines.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Timeout limits a single attempt, including reading the body.
+	Timeout time.Duration
+	// MaxRetries is how many times a failed request is tried again.
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry, doubled on every
+	// following one up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// RequestsPerSecond limits all requests made through the client.
+	// Zero means no limit.
+	RequestsPerSecond float64
+	// Jar, when set, stores the cookies of every response and sends them
+	// back, e.g. a logged in session from LoadCookies.
+	Jar http.CookieJar
+}
+
+// DefaultConfig is what the client uses when no flags change it.
+var DefaultConfig = Config{
+	Timeout:           30 * time.Second,
+	MaxRetries:        4,
+	BaseDelay:         500 * time.Millisecond,
+	MaxDelay:          30 * time.Second,
+	RequestsPerSecond: 4,
+}
+
+type Client struct {
+	http    *http.Client
+	config  Config
+	limiter *limiter
+}
+
+func New(config Config) *Client {
+	return &Client{
+		http:    &http.Client{Timeout: config.Timeout, Jar: config.Jar},
+		config:  config,
+		limiter: newLimiter(config.RequestsPerSecond),
+	}
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultClient = New(DefaultConfig)
+)
+
+// Default returns the client shared by all site adapters.
+func Default() *Client {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultClient
+}
+
+// SetDefault replaces the shared client, e.g. after reading the CLI flags.
+func SetDefault(c *Client) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultClient = c
+}
+
+// HTTP exposes the underlying *http.Client, e.g. to set a cookie jar.
+func (c *Client) HTTP() *http.Client {
+	return c.http
+}
+
+// StatusError is returned when the server keeps answering with an error status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: o código é %d", e.URL, e.StatusCode)
+}
+
+// Get is Do with a plain GET request.
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends req, waiting for the rate limiter first and retrying network
+// errors, 429 and 5xx answers. A Retry-After header from the server takes the
+// place of the computed backoff. Other status codes are returned as they are.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errors.New("fetch: can't retry a request whose body can't be replayed")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		if err := c.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.http.Do(req)
+
+		retry := err != nil || retryable(resp.StatusCode)
+		if !retry || attempt >= c.config.MaxRetries || ctx.Err() != nil {
+			if err == nil && retryable(resp.StatusCode) {
+				resp.Body.Close()
+				return nil, &StatusError{URL: req.URL.String(), StatusCode: resp.StatusCode}
+			}
+			return resp, err
+		}
+
+		delay := c.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = after
+			}
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// backoff is BaseDelay * 2^attempt capped at MaxDelay, with full jitter so
+// parallel workers don't retry in lockstep.
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.config.BaseDelay << attempt
+	if delay <= 0 || (c.config.MaxDelay > 0 && delay > c.config.MaxDelay) {
+		delay = c.config.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(delay))) + 1
+}
+
+// retryAfter understands both forms of the header: seconds or an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(time.Until(when), 0), true
+	}
+	return 0, false
+}
+
+// limiter hands out evenly spaced slots, rps per second.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(rps float64) *limiter {
+	if rps <= 0 {
+		return &limiter{}
+	}
+	return &limiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,178 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadCookies reads the cookies exported from a browser into a new jar. path
+// is either a Netscape cookies.txt or a JSON array of cookies, as written by
+// the usual cookie export extensions (a {"cookies": [...]} object works too).
+// Errors name the file and line but never a cookie's value.
+func LoadCookies(path string) (http.CookieJar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cookies []hostCookie
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		cookies, err = parseJSONCookies(trimmed)
+	} else {
+		cookies, err = parseNetscapeCookies(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, c := range cookies {
+		// a cookie with an expiry in the past would just be thrown away by the jar
+		if !c.cookie.Expires.IsZero() && c.cookie.Expires.Before(now) {
+			continue
+		}
+		jar.SetCookies(c.url(), []*http.Cookie{c.cookie})
+	}
+
+	return jar, nil
+}
+
+// hostCookie is a cookie together with the host it was set by, which the jar
+// needs to accept it.
+type hostCookie struct {
+	host   string
+	cookie *http.Cookie
+}
+
+func (c hostCookie) url() *url.URL {
+	scheme := "http"
+	if c.cookie.Secure {
+		scheme = "https"
+	}
+	path := c.cookie.Path
+	if path == "" {
+		path = "/"
+	}
+	return &url.URL{Scheme: scheme, Host: strings.TrimPrefix(c.host, "."), Path: path}
+}
+
+// parseNetscapeCookies reads the tab separated format of curl and wget:
+// domain, include subdomains, path, secure, expiry, name and value.
+func parseNetscapeCookies(data []byte) ([]hostCookie, error) {
+	var cookies []hostCookie
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(text, "#HttpOnly_"); ok {
+			text, httpOnly = rest, true
+		}
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("linha %d: esperava 7 campos separados por tab, tem %d", line, len(fields))
+		}
+
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("linha %d: validade '%s' inválida", line, fields[4])
+		}
+
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		cookie.Domain = cookieDomain(fields[0], strings.EqualFold(fields[1], "TRUE"))
+		if expiry > 0 {
+			cookie.Expires = time.Unix(expiry, 0)
+		}
+		cookies = append(cookies, hostCookie{host: fields[0], cookie: cookie})
+	}
+
+	return cookies, scanner.Err()
+}
+
+// jsonCookie covers the field names of the common exporters: expirationDate
+// comes from browser extensions, expires from Playwright and Puppeteer.
+type jsonCookie struct {
+	Domain         string  `json:"domain"`
+	Name           string  `json:"name"`
+	Value          string  `json:"value"`
+	Path           string  `json:"path"`
+	Secure         bool    `json:"secure"`
+	HttpOnly       bool    `json:"httpOnly"`
+	HostOnly       bool    `json:"hostOnly"`
+	ExpirationDate float64 `json:"expirationDate"`
+	Expires        float64 `json:"expires"`
+}
+
+func parseJSONCookies(data []byte) ([]hostCookie, error) {
+	var list []jsonCookie
+
+	if data[0] == '{' {
+		var wrapper struct {
+			Cookies []jsonCookie `json:"cookies"`
+		}
+		if err := json.Unmarshal(data, &wrapper); err != nil {
+			return nil, fmt.Errorf("json de cookies inválido: %w", err)
+		}
+		list = wrapper.Cookies
+	} else if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("json de cookies inválido: %w", err)
+	}
+
+	var cookies []hostCookie
+	for i, c := range list {
+		if c.Name == "" || c.Domain == "" {
+			return nil, fmt.Errorf("cookie %d: falta o nome ou o domínio", i+1)
+		}
+
+		cookie := &http.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+			Domain:   cookieDomain(c.Domain, !c.HostOnly),
+		}
+		// Playwright writes -1 for session cookies
+		if expiry := max(c.ExpirationDate, c.Expires); expiry > 0 {
+			cookie.Expires = time.Unix(int64(expiry), 0)
+		}
+		cookies = append(cookies, hostCookie{host: c.Domain, cookie: cookie})
+	}
+
+	return cookies, nil
+}
+
+// cookieDomain returns the Domain attribute to give the jar: empty for a
+// host-only cookie, so it isn't sent to subdomains.
+func cookieDomain(domain string, subdomains bool) string {
+	if !subdomains && !strings.HasPrefix(domain, ".") {
+		return ""
+	}
+	return domain
+}
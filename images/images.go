@@ -0,0 +1,99 @@
+// Package images downloads the images of a chapter into the book, whatever
+// site the chapter came from, through the shared fetch client.
+package images
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/fetch"
+	"wattpad-to-ebook/pool"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// DownloadAndRewrite downloads the images of a chapter, up to workers at a
+// time, and points their src at ../images/<name>, where the returned images
+// go in the book. The files are named chapter<chapIndex>_img<position>, so
+// the names don't depend on which download finishes first. Images that can't
+// be downloaded keep their original src. Images without an alt text get
+// their caption as one, or an empty alt when there's nothing to say.
+func DownloadAndRewrite(ctx context.Context, htmlContent []byte, chapIndex int, workers int) (string, []ebook.Image, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(htmlContent))
+	if err != nil {
+		return "", nil, err
+	}
+
+	imgs := doc.Find("img")
+	downloaded := make([]*ebook.Image, imgs.Length())
+
+	err = pool.Run(ctx, workers, imgs.Length(), func(ctx context.Context, i int) error {
+		src, exists := imgs.Eq(i).Attr("src")
+		if !exists || strings.TrimSpace(src) == "" {
+			return nil
+		}
+
+		// Download da imagem; se falhar a imagem só fica de fora
+		res, err := fetch.Default().Get(ctx, src)
+		if err != nil {
+			return nil
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return nil
+		}
+
+		// Detectar tipo da imagem
+		buf, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil
+		}
+
+		contentType := mimetype.Detect(buf)
+
+		downloaded[i] = &ebook.Image{
+			Name:      fmt.Sprintf("chapter%d_img%d%s", chapIndex, i, contentType.Extension()),
+			Data:      buf,
+			MediaType: contentType.String(),
+		}
+		return nil
+	})
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	var images []ebook.Image
+
+	imgs.Each(func(i int, s *goquery.Selection) {
+		// story sites almost never have an alt; a caption is the only real
+		// description there can be, and without one an empty alt makes
+		// screen readers skip the image instead of reading its file name
+		if alt, _ := s.Attr("alt"); strings.TrimSpace(alt) == "" {
+			s.SetAttr("alt", strings.TrimSpace(s.AttrOr("data-caption", s.AttrOr("title", ""))))
+		}
+
+		if downloaded[i] == nil {
+			return
+		}
+
+		s.SetAttr("src", fmt.Sprintf("../images/%s", downloaded[i].Name))
+		s.SetAttr("width", "100%")
+
+		images = append(images, *downloaded[i])
+	})
+
+	htmlBody, err := doc.Html()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return htmlBody, images, nil
+}
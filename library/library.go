@@ -0,0 +1,223 @@
+// Package library remembers which stories were downloaded, what their parts
+// looked like and where the EPUB was written, so a story can be updated by
+// fetching only what changed.
+package library
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"wattpad-to-ebook/pdf"
+	"wattpad-to-ebook/sources"
+)
+
+const indexFile = "library.json"
+
+type Chapter struct {
+	ID    string `json:"id"`
+	Index int    `json:"index"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	// Hash is the sha256 of the chapter HTML as the source returned it.
+	Hash   string `json:"hash"`
+	Pages  int    `json:"pages"`
+	Locked bool   `json:"locked,omitempty"`
+}
+
+type Story struct {
+	// Key is "<source>:<story id>", see Key.
+	Key         string    `json:"key"`
+	Source      string    `json:"source"`
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Name        string    `json:"name"`
+	Author      string    `json:"author"`
+	Chapters    []Chapter `json:"chapters"`
+	LastFetched time.Time `json:"last_fetched"`
+	OutputPath  string    `json:"output_path"`
+	// Format is the format of the book at OutputPath, empty for EPUB.
+	Format string `json:"format,omitempty"`
+	// Split is set when OutputPath is a directory with a text file per chapter.
+	Split bool `json:"split,omitempty"`
+	// PDF is the page setup of a PDF book, reused by update. Nil means
+	// pdf.DefaultConfig.
+	PDF *pdf.Config `json:"pdf,omitempty"`
+	// Selection is the subset of parts the book was made from, reused by
+	// update. Nil means every part.
+	Selection *sources.Selection `json:"selection,omitempty"`
+}
+
+// Library is a directory holding library.json and a cache with the HTML of
+// every chapter, one folder per story.
+// Its methods can be called from several goroutines at once.
+type Library struct {
+	dir     string
+	mu      sync.Mutex
+	Stories map[string]*Story `json:"stories"`
+}
+
+// Changes is what an update found when comparing a story with its record.
+type Changes struct {
+	Added   []Chapter
+	Removed []Chapter
+	Edited  []Chapter
+}
+
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Edited) == 0
+}
+
+// DefaultDir is where the library lives when no -library flag is given.
+func DefaultDir() (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config, "wattpad-to-ebook"), nil
+}
+
+// Key identifies a story inside the library.
+func Key(source string, storyID string) string {
+	return source + ":" + storyID
+}
+
+// Hash returns the content hash stored for a chapter body.
+func Hash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Open loads the library in dir, creating an empty one if it doesn't exist yet.
+func Open(dir string) (*Library, error) {
+	lib := &Library{dir: dir, Stories: map[string]*Story{}}
+
+	content, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return lib, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, lib); err != nil {
+		return nil, fmt.Errorf("library %s: %w", dir, err)
+	}
+	if lib.Stories == nil {
+		lib.Stories = map[string]*Story{}
+	}
+	return lib, nil
+}
+
+// Save writes library.json, replacing the old one only once the new one is complete.
+func (l *Library) Save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(l.dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(l.dir, indexFile+".tmp")
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(l.dir, indexFile))
+}
+
+// Dir is the directory the library is stored in.
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+func (l *Library) Get(key string) (*Story, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	story, ok := l.Stories[key]
+	return story, ok
+}
+
+// Put stores story under its key, replacing any older record.
+func (l *Library) Put(story *Story) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Stories[story.Key] = story
+}
+
+// Find returns the story whose key or url matches ref.
+func (l *Library) Find(ref string) (*Story, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if story, ok := l.Stories[ref]; ok {
+		return story, true
+	}
+	for _, story := range l.Stories {
+		if story.URL == ref {
+			return story, true
+		}
+	}
+	return nil, false
+}
+
+func (l *Library) chapterPath(key string, chapterID string) string {
+	folder := strings.NewReplacer(":", "_", "/", "_", `\`, "_").Replace(key)
+	return filepath.Join(l.dir, "stories", folder, chapterID+".html")
+}
+
+// ChapterText returns the cached HTML of a chapter.
+func (l *Library) ChapterText(key string, chapterID string) ([]byte, error) {
+	return os.ReadFile(l.chapterPath(key, chapterID))
+}
+
+// SaveChapterText caches the HTML of a chapter.
+func (l *Library) SaveChapterText(key string, chapterID string, body []byte) error {
+	path := l.chapterPath(key, chapterID)
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, body, 0644)
+}
+
+// RemoveChapterText drops a chapter from the cache, ignoring missing files.
+func (l *Library) RemoveChapterText(key string, chapterID string) error {
+	err := os.Remove(l.chapterPath(key, chapterID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// NewChapter builds the record of a chapter that was just fetched.
+func NewChapter(chapter sources.Story_Chapters, body []byte) Chapter {
+	return Chapter{
+		ID:     chapter.ID,
+		Index:  chapter.Index,
+		Title:  chapter.Title,
+		URL:    chapter.URL,
+		Hash:   Hash(body),
+		Pages:  chapter.Pages,
+		Locked: chapter.Locked,
+	}
+}
+
+// ChapterByID looks a chapter up by its source id.
+func (s *Story) ChapterByID(id string) (Chapter, bool) {
+	for _, chapter := range s.Chapters {
+		if chapter.ID == id {
+			return chapter, true
+		}
+	}
+	return Chapter{}, false
+}
@@ -1,145 +1,462 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
 	"wattpad-to-ebook/ebook"
-	"wattpad-to-ebook/wattpad_stories"
-
-	"github.com/yosssi/gohtml"
+	"wattpad-to-ebook/fetch"
+	"wattpad-to-ebook/library"
+	"wattpad-to-ebook/pdf"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/sources"
+
+	// site adapters register themselves with the sources package
+	_ "wattpad-to-ebook/wattpad_stories"
 )
 
 
-func download_wattpad(url string) error {
-	chapters, metadata, err := wattpadstories.Get_Chapters(url)
-	
-	// fmt.Println(metadata)
-	
-	epubName := fmt.Sprintf("%s - %s.epub", metadata.Name, metadata.Author)
-	// fmt.Println(epubName)
-	if err != nil {
-		return err
+// open_library opens the library in dir, or the default one when dir is empty.
+func open_library(dir string) (*library.Library, error) {
+	if dir == "" {
+		defaultDir, err := library.DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = defaultDir
+	}
+	return library.Open(dir)
+}
+
+// add_http_flags registers the flags of the shared HTTP client on fs. The
+// returned function installs the configured client once fs was parsed.
+func add_http_flags(fs *flag.FlagSet) func() {
+	config := fetch.DefaultConfig
+	fs.DurationVar(&config.Timeout, "timeout", config.Timeout, "timeout of a single HTTP request")
+	fs.IntVar(&config.MaxRetries, "retries", config.MaxRetries, "how many times a request is retried on 429, 5xx or network errors")
+	fs.Float64Var(&config.RequestsPerSecond, "rps", config.RequestsPerSecond, "maximum requests per second, 0 for no limit")
+	cookies := fs.String("cookies", "", "Netscape cookies.txt or JSON cookie export with a logged in session")
+
+	return func() {
+		if *cookies != "" {
+			// only the file name goes to the log, never the cookies
+			jar, err := fetch.LoadCookies(*cookies)
+			if err != nil {
+				log.Fatalf("não deu para ler os cookies: %v", err)
+			}
+			config.Jar = jar
+		}
+		fetch.SetDefault(fetch.New(config))
 	}
+}
 
-	tempDir, err := ebook.Setup_temp()
+// add_paywall_flag registers -paywalled on fs. The returned function checks
+// the value once fs was parsed.
+func add_paywall_flag(fs *flag.FlagSet) func() pipeline.PaywallPolicy {
+	value := fs.String("paywalled", string(pipeline.PaywallPlaceholder), "what to do with paywalled parts: placeholder, skip or abort")
 
-	if err != nil {
-		return err
+	return func() pipeline.PaywallPolicy {
+		policy, err := pipeline.ParsePaywallPolicy(*value)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			fs.Usage()
+			os.Exit(2)
+		}
+		return policy
 	}
+}
 
-	err = ebook.Setup_container(tempDir)
+// add_selection_flags registers -from, -to, -chapters and -latest on fs. The
+// returned function builds the selection once fs was parsed.
+func add_selection_flags(fs *flag.FlagSet) func() sources.Selection {
+	var selection sources.Selection
+	fs.IntVar(&selection.From, "from", 0, "first part to convert")
+	fs.IntVar(&selection.To, "to", 0, "last part to convert")
+	parts := fs.String("chapters", "", "parts to convert, like 1,3,5-9")
+	fs.IntVar(&selection.Latest, "latest", 0, "convert only the newest N parts")
+
+	return func() sources.Selection {
+		var err error
+		switch {
+		case selection.From < 0 || selection.To < 0 || selection.Latest < 0:
+			err = fmt.Errorf("-from, -to e -latest não podem ser negativos")
+		case selection.To > 0 && selection.From > selection.To:
+			err = fmt.Errorf("-from %d vem depois de -to %d", selection.From, selection.To)
+		case *parts != "":
+			selection.Parts, err = sources.ParseRanges(*parts)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			fs.Usage()
+			os.Exit(2)
+		}
+		return selection
+	}
+}
 
-	if err != nil {
-		return err
+// add_format_flags registers -format, -split, -page-size and -margin on fs.
+// The returned function checks them once fs was parsed and sets them on opts.
+func add_format_flags(fs *flag.FlagSet) func(opts *pipeline.Options) {
+	format := fs.String("format", string(pipeline.FormatEPUB), "output format: epub, kepub (Kobo), pdf, md (Markdown), txt, html (a single page), fb2, fb2.zip (FictionBook) or docx (Word)")
+	split := fs.Bool("split", false, "with -format md or txt, write a directory with a file per chapter")
+	pageSize := fs.String("page-size", "a4", "PDF page size: a4, a5, a6, letter, legal or WIDTHxHEIGHT like 6x9in or 150x220mm")
+	margin := fs.String("margin", "18mm", "PDF page margin, in mm, cm, in or pt")
+
+	return func(opts *pipeline.Options) {
+		parsed, err := pipeline.ParseFormat(*format)
+		config := pdf.DefaultConfig()
+		if err == nil {
+			config.PageSize, err = pdf.ParsePageSize(*pageSize)
+		}
+		if err == nil {
+			config.Margin, err = pdf.ParseLength(*margin)
+		}
+		if err == nil && *split && parsed != pipeline.FormatMarkdown && parsed != pipeline.FormatText {
+			err = fmt.Errorf("-split só funciona com -format md ou txt")
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			fs.Usage()
+			os.Exit(2)
+		}
+		opts.Format, opts.Split, opts.PDF = parsed, *split, config
+	}
+}
+
+// format_label is how the format is named in messages, like EPUB or PDF.
+func format_label(format pipeline.Format) string {
+	if format == "" {
+		format = pipeline.FormatEPUB
 	}
+	return strings.ToUpper(string(format))
+}
 
-	err = ebook.SetupImg(tempDir)
+// print_paywalled lists the parts that were behind a paywall and what was done with them.
+func print_paywalled(w io.Writer, name string, parts []sources.Story_Chapters, policy pipeline.PaywallPolicy) {
+	if len(parts) == 0 {
+		return
+	}
 
-	if err != nil {
-		return err
-	}
-	anyImage := false
-
-	for _, chapter := range chapters {
-    bodyBytes, err := wattpadstories.Get_Chapter_Text(chapter.URL)
-    if err != nil {
-        return err
-    }
-
-    modifiedBody, foundImage, err := wattpadstories.DownloadAndRewriteImages(bodyBytes, tempDir, chapter.Index)
-    if err != nil {
-        return err
-    }
-
-    if foundImage {
-        anyImage = true
-    }
-
-    pretty := gohtml.Format(modifiedBody)
-    err = ebook.AddChapters(pretty, chapter.Index, tempDir, chapter.Title)
-    if err != nil {
-        return err
-    }
+	action := "replaced by a placeholder page"
+	if policy == pipeline.PaywallSkip {
+		action = "left out of the book"
+	}
+
+	fmt.Fprintf(w, "%s: %d paywalled parts %s:\n", name, len(parts), action)
+	for _, part := range parts {
+		fmt.Fprintf(w, "  $ %d. %s\n", part.Index, part.Title)
+	}
 }
 
-	imgDir, err := os.ReadDir(filepath.Join(tempDir, "images"))
+func print_changes(name string, changes library.Changes) {
+	if changes.Empty() {
+		fmt.Printf("%s: up to date\n", name)
+		return
+	}
+
+	fmt.Printf("%s:\n", name)
+	for _, chap := range changes.Added {
+		fmt.Printf("  + added   %d. %s\n", chap.Index, chap.Title)
+	}
+	for _, chap := range changes.Removed {
+		fmt.Printf("  - removed %d. %s\n", chap.Index, chap.Title)
+	}
+	for _, chap := range changes.Edited {
+		fmt.Printf("  ~ edited  %d. %s\n", chap.Index, chap.Title)
+	}
+}
 
+// run_update implements `wattpad-to-ebook update [flags] [url or key...]`.
+// Without arguments every story in the library is updated.
+func run_update(args []string) {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	libDir := fs.String("library", "", "directory of the local library (default: user config dir)")
+	recheck := fs.Bool("recheck", false, "also re-download known parts to find edited ones")
+	concurrency := fs.Int("concurrency", 4, "how many chapters or images to download at the same time")
+	paywalled := add_paywall_flag(fs)
+	setup_http := add_http_flags(fs)
+	fs.Parse(args)
+	setup_http()
+	policy := paywalled()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := pipeline.Options{Concurrency: *concurrency, Recheck: *recheck, Paywalled: policy}
+
+	lib, err := open_library(*libDir)
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
 
-	err = ebook.Setup_content(tempDir, len(chapters), metadata.Name, metadata.Author, metadata.Description, metadata.CoverImageType, imgDir)
+	var stories []*library.Story
+	if fs.NArg() == 0 {
+		for _, story := range lib.Stories {
+			stories = append(stories, story)
+		}
+	}
+	for _, ref := range fs.Args() {
+		story, ok := lib.Find(ref)
+		if !ok {
+			log.Fatalf("'%s' não está na biblioteca, baixe com -u primeiro", ref)
+		}
+		stories = append(stories, story)
+	}
 
-	if err != nil {
-		return err
+	if len(stories) == 0 {
+		fmt.Println("The library is empty")
+		return
 	}
 
-	err = ebook.Setup_CSS(tempDir)
+	for _, story := range stories {
+		src, err := sources.For(story.URL)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	if err != nil {
-		return err
+		result, err := pipeline.Update(ctx, src, lib, story, opts)
+		if err != nil {
+			log.Fatalf("%s: %v", story.Name, err)
+		}
+		print_changes(story.Name, result.Changes)
+		print_paywalled(os.Stdout, story.Name, result.Paywalled, policy)
 	}
+}
 
-	var nav_chapters []ebook.ChapterNavItem
+// read_urls reads the story urls listed in the file at path, or stdin for "-".
+func read_urls(path string) []string {
+	input := os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		input = file
+	}
 
-	for i, chap := range chapters {
-		nav_chapters = append(nav_chapters, ebook.ChapterNavItem{Href: fmt.Sprintf("chapter_%d.xhtml", i+1), Title: chap.Title})
+	urls, err := pipeline.ReadURLs(input)
+	if err != nil {
+		log.Fatal(err)
 	}
+	return urls
+}
 
-	err = ebook.Setup_Nav(tempDir, nav_chapters, metadata.Name)
-	
+// run_batch converts every story in urls, and in the lists among them, and
+// prints a table with how each one went. It returns the exit code: 1 when any
+// story failed.
+func run_batch(urls []string, libDir string, opts pipeline.Options, parallel int) int {
+	if len(urls) == 0 {
+		fmt.Println("No story URLs to convert")
+		return 0
+	}
+
+	lib, err := open_library(libDir)
 	if err != nil {
-		return err
+		log.Printf("library unavailable, the stories won't be recorded: %v", err)
+		lib = nil
 	}
-	
 
-	
-	var chap_list = []ebook.ChapterNavItem{}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Generating %ss, %d stories at a time\n", format_label(opts.Format), max(parallel, 1))
+	results := pipeline.Batch(ctx, urls, lib, opts, parallel)
+
+	failed := 0
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "\nSTATUS\tURL\tRESULT")
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(table, "failed\t%s\t%v\n", result.URL, result.Err)
+			continue
+		}
 
-	for i, chap := range chapters {
-		chap_list = append(chap_list, ebook.ChapterNavItem{Href: fmt.Sprintf("chapter_%d.xhtml", i+1), Title: chap.Title})
+		detail := result.Result.Output
+		if n := len(result.Result.Paywalled); n > 0 {
+			detail += fmt.Sprintf(" (%d paywalled parts)", n)
+		}
+		fmt.Fprintf(table, "ok\t%s\t%s\n", result.URL, detail)
 	}
+	table.Flush()
 
-	err = ebook.SetupToc(tempDir, metadata.Name, chap_list)
-	
-	if err != nil {
-		return err
+	fmt.Printf("%d converted, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		return 1
 	}
+	return 0
+}
 
+// run_omnibus writes every story of list into one EPUB.
+func run_omnibus(list sources.StoryList, opts pipeline.Options) {
+	messages := os.Stdout
+	if opts.Output == "-" {
+		messages = os.Stderr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	ebook.Make_Ebook(tempDir, epubName, metadata.CoverImage, metadata.CoverImageType, anyImage)
-	
-	os.RemoveAll(tempDir)
-	
-	return nil
+	fmt.Fprintf(messages, "Generating an omnibus %s of %d stories: %s\n", format_label(opts.Format), len(list.URLs), list.Name)
+	result, err := pipeline.Omnibus(ctx, list, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(messages, format_label(opts.Format), "Generated Successfully:", result.Output)
+	print_paywalled(messages, list.Name, result.Paywalled, opts.Paywalled)
 }
 
+// run_validate implements `wattpad-to-ebook validate file.epub...` and exits
+// with 1 when any book has errors.
+func run_validate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Parse(args)
 
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Error: validate needs at least one .epub file.")
+		os.Exit(1)
+	}
 
+	failed := false
+	for _, epub := range fs.Args() {
+		findings, err := ebook.Validate(epub)
+		if err != nil {
+			fmt.Printf("FATAL(PKG-008): %s: Unable to read file: %v\n", epub, err)
+			failed = true
+			continue
+		}
+
+		errorCount, warningCount := 0, 0
+		for _, finding := range findings {
+			fmt.Println(finding.Format(filepath.Base(epub)))
+			if finding.Severity == ebook.SeverityError {
+				errorCount++
+			} else {
+				warningCount++
+			}
+		}
+
+		fmt.Printf("%s: %d errors / %d warnings\n", epub, errorCount, warningCount)
+		if errorCount > 0 {
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
 
 func main(){
-	url := flag.String("u", "", "URL of the story (required)")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "update":
+			run_update(os.Args[2:])
+			return
+		case "validate":
+			run_validate(os.Args[2:])
+			return
+		}
+	}
+
+	url := flag.String("u", "", "URL of the story (required unless -batch is given)")
+	batch := flag.String("batch", "", "file with one story URL per line, - for stdin")
+	parallel := flag.Int("parallel", 2, "how many stories of a -batch or list to convert at the same time")
+	omnibus := flag.Bool("omnibus", false, "put every story of a reading list or author into a single book")
+	libDir := flag.String("library", "", "directory of the local library (default: user config dir)")
+	concurrency := flag.Int("concurrency", 4, "how many chapters or images to download at the same time")
+	output := flag.String("o", "", "output file (default \"<title> - <author>.<format>\", - for stdout)")
+	paywalled := add_paywall_flag(flag.CommandLine)
+	selected := add_selection_flags(flag.CommandLine)
+	formatted := add_format_flags(flag.CommandLine)
+	setup_http := add_http_flags(flag.CommandLine)
 	flag.Parse()
+	setup_http()
+	policy := paywalled()
+	selection := selected()
 
-	if *url == "" {
+	switch {
+	case *url == "" && *batch == "":
 		fmt.Fprintln(os.Stderr, "Error: -u is required.")
 		flag.Usage()
 		os.Exit(1)
+	case *url != "" && *batch != "":
+		fmt.Fprintln(os.Stderr, "Error: use either -u or -batch.")
+		os.Exit(1)
+	case *batch != "" && *output != "" && !*omnibus:
+		fmt.Fprintln(os.Stderr, "Error: -o can't be used with -batch without -omnibus, every story gets its own file.")
+		os.Exit(1)
 	}
 
-	// Proceed normally
-	if strings.Contains(*url, "www.wattpad.com/story"){
-		fmt.Println("Generating EPUB for:", *url)
-		err := download_wattpad(*url)
+	opts := pipeline.Options{Concurrency: *concurrency, Output: *output, Paywalled: policy, Selection: selection}
+	formatted(&opts)
+
+	if *batch != "" && *omnibus {
+		// a series split in several stories: the file names the book
+		name := strings.TrimSuffix(filepath.Base(*batch), filepath.Ext(*batch))
+		list := sources.StoryList{ID: "batch-" + name, Name: name, URLs: read_urls(*batch)}
+		run_omnibus(list, opts)
+		return
+	}
+
+	if *batch != "" {
+		os.Exit(run_batch(read_urls(*batch), *libDir, opts, *parallel))
+	}
+
+	lister, isList := sources.ListerFor(*url)
+	switch {
+	case isList && *omnibus:
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		list, err := lister.List(ctx, *url)
+		stop()
 		if err != nil {
 			log.Fatal(err)
 		}
-		fmt.Println("Epub Generated Successfully")
-	} else {
-		log.Fatalf("A url '%s' não é válida da story do wattpad", *url)
+		run_omnibus(list, opts)
+		return
+	case isList && *output != "":
+		fmt.Fprintln(os.Stderr, "Error: -o can't be used with a list without -omnibus, every story gets its own file.")
+		os.Exit(1)
+	case isList:
+		os.Exit(run_batch([]string{*url}, *libDir, opts, *parallel))
+	case *omnibus:
+		fmt.Fprintln(os.Stderr, "Error: -omnibus needs the URL of a reading list or author, or -batch.")
+		os.Exit(1)
 	}
-}
\ No newline at end of file
+
+	src, err := sources.For(*url)
+	if err != nil {
+		log.Fatalf("A url '%s' não é válida para nenhuma fonte suportada (%v)", *url, sources.Names())
+	}
+
+	lib, err := open_library(*libDir)
+	if err != nil {
+		// a biblioteca é opcional para um download simples
+		log.Printf("library unavailable, the story won't be recorded: %v", err)
+		lib = nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// with -o - the epub itself goes to stdout, so the messages can't
+	messages := os.Stdout
+	if *output == "-" {
+		messages = os.Stderr
+	}
+
+	fmt.Fprintln(messages, "Generating", format_label(opts.Format), "for:", *url)
+	result, err := pipeline.Download(ctx, src, *url, lib, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(messages, format_label(opts.Format), "Generated Successfully")
+	print_paywalled(messages, *url, result.Paywalled, policy)
+}
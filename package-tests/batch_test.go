@@ -0,0 +1,56 @@
+package packagetests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"wattpad-to-ebook/library"
+	"wattpad-to-ebook/pipeline"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_batch_readURLs(t *testing.T) {
+	input := `# histórias do clube
+https://www.wattpad.com/story/1-a
+
+   https://www.wattpad.com/story/2-b   # essa está pela metade
+#https://www.wattpad.com/story/3-c
+`
+	urls, err := pipeline.ReadURLs(strings.NewReader(input))
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, []string{"https://www.wattpad.com/story/1-a", "https://www.wattpad.com/story/2-b"}, urls)
+}
+
+func Test_batch_keepsGoing(t *testing.T) {
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	lib, err := library.Open(t.TempDir())
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	urls := []string{
+		fake.URL + "/story/389173089-manager%27s-duties",
+		fake.URL + "/story/123-does-not-exist",
+		"https://example.com/not-a-story",
+		fake.URL + "/story/388706112-sole-elite-disclosed",
+	}
+
+	results := pipeline.Batch(context.Background(), urls, lib, pipeline.Options{Concurrency: 2}, 3)
+	require.Len(t, results, 4)
+
+	for i, result := range results {
+		require.Equal(t, urls[i], result.URL, "os resultados tinham que vir na ordem das urls")
+	}
+
+	require.Nilf(t, results[0].Err, "Não era pra ter erro, mas tem\nErro: ", results[0].Err)
+	require.FileExists(t, results[0].Result.Output)
+	require.Error(t, results[1].Err, "a história que não existe tinha que falhar")
+	require.Error(t, results[2].Err, "a url sem fonte tinha que falhar")
+	require.Nilf(t, results[3].Err, "Não era pra ter erro, mas tem\nErro: ", results[3].Err)
+	require.FileExists(t, results[3].Result.Output)
+
+	reopened, err := library.Open(lib.Dir())
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Len(t, reopened.Stories, 2, "as duas histórias que deram certo tinham que estar na biblioteca")
+}
@@ -0,0 +1,279 @@
+package packagetests
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/sources"
+	"wattpad-to-ebook/wattpad_stories"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_book_writeToAnyWriter(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "In Memory", Author: "Nobody", Description: "sem diretório temporário"})
+
+	err := book.AddChapter(1, "One", `<p>first <img src="../images/chapter1_img0.png"/></p>`)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	err = book.AddChapter(2, "Two", "<p>second</p>")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Error(t, book.AddChapter(2, "Two again", "<p>again</p>"), "o mesmo capítulo não pode entrar duas vezes")
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x02\x00\x00\x00")
+	err = book.AddImage(ebook.Image{Name: "chapter1_img0.png", Data: png})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, "image/png", book.Images()[0].MediaType, "o tipo da imagem era para ser detectado")
+
+	var buf bytes.Buffer
+	n, err := book.WriteTo(&buf)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, int64(buf.Len()), n)
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, "mimetype", r.File[0].Name)
+	require.Empty(t, ebook.ValidateZip(r), "o livro em memória não passou na validação")
+}
+
+func Test_book_withoutChapters(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Empty"})
+
+	var buf bytes.Buffer
+	_, err := book.WriteTo(&buf)
+	require.Error(t, err, "um livro sem capítulos não era para ser escrito")
+}
+
+func Test_book_stableIdentifier(t *testing.T) {
+	metadata := sources.Story_Metadata{Source: "wattpad", ID: "389173089", Name: "Manager's Duties", Author: "quietwriter"}
+
+	book := ebook.NewBook(metadata)
+	require.Equal(t, "urn:uuid:4c5e96ca-fe75-58f6-bd7d-596d60ae5f8e", book.Identifier(), "era para ser o UUIDv5 de urn:wattpad:389173089")
+	require.Equal(t, "urn:wattpad:389173089", book.SourceIdentifier())
+
+	// o título muda, o id não
+	metadata.Name = "Manager's Duties (rewrite)"
+	require.Equal(t, book.Identifier(), ebook.NewBook(metadata).Identifier())
+
+	metadata.ID = "388706112"
+	require.NotEqual(t, book.Identifier(), ebook.NewBook(metadata).Identifier(), "histórias diferentes não podem ter o mesmo id")
+}
+
+func Test_book_identifierInPackage(t *testing.T) {
+	fake := newFakeWattpad(t)
+
+	chapters, metadata, err := wattpadstories.Get_Chapters(context.Background(), fake.URL+"/story/389173089-manager%27s-duties")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	book := ebook.NewBook(metadata)
+	err = book.AddChapter(chapters[0].Index, chapters[0].Title, "<p>texto</p>")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	opf, err := ebook.GenerateContentOPF(book)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Contains(t, string(opf), `<dc:identifier id="id">urn:uuid:4c5e96ca-fe75-58f6-bd7d-596d60ae5f8e</dc:identifier>`)
+	require.Contains(t, string(opf), `<dc:identifier id="source-id">urn:wattpad:389173089</dc:identifier>`)
+	require.NotContains(t, string(opf), "quikmcbu")
+
+	var buf bytes.Buffer
+	_, err = book.WriteTo(&buf)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	for _, f := range r.File {
+		if f.Name != "OEBPS/toc.ncx" {
+			continue
+		}
+		rc, err := f.Open()
+		require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+		ncx, _ := io.ReadAll(rc)
+		rc.Close()
+		require.Contains(t, string(ncx), `<meta name="dtb:uid" content="urn:uuid:4c5e96ca-fe75-58f6-bd7d-596d60ae5f8e">`)
+	}
+}
+
+func Test_book_frontMatter(t *testing.T) {
+	fake, result := downloadAs(t, pipeline.FormatEPUB)
+	url := fake.URL + soleElite
+	files := readZip(t, result.Output)
+
+	title := files["OEBPS/title_page.xhtml"]
+	require.Contains(t, title, `<img src="../cover.jpg" alt="Sole Elite Disclosed" width="100%"/>`)
+	require.Contains(t, title, "<p>by cote_fan</p>")
+	require.Contains(t, title, `<a href="`+url+`">`)
+	require.Contains(t, title, "Downloaded on ")
+
+	intro := files["OEBPS/introduction.xhtml"]
+	require.Contains(t, intro, "<p>What if the class knew from the start?</p>")
+	require.Contains(t, intro, "<dt>Status</dt><dd>Ongoing</dd>")
+	require.Contains(t, intro, "<dt>Tags</dt><dd>classroomoftheelite, fanfiction</dd>")
+	require.Contains(t, intro, "<dt>Reads</dt><dd>15,230</dd><dt>Votes</dt><dd>842</dd>")
+
+	// as duas páginas vêm antes do primeiro capítulo no spine, no nav e no ncx
+	opf := files["OEBPS/content.opf"]
+	require.Regexp(t, `(?s)<itemref idref="title_page"></itemref>\s*<itemref idref="introduction"></itemref>\s*<itemref idref="chapter_1">`, opf)
+	require.Regexp(t, `(?s)href="title_page.xhtml">Title Page</a>.*href="introduction.xhtml">Introduction</a>.*href="chapter_1.xhtml"`, files["OEBPS/nav.xhtml"])
+	require.Regexp(t, `(?s)<navPoint id="navpoint_1" playOrder="1">\s*<navLabel>\s*<text>Title Page</text>.*<text>Introduction</text>.*<text>Prologue</text>`, files["OEBPS/toc.ncx"])
+
+	findings, err := ebook.Validate(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Empty(t, findings)
+}
+
+func Test_book_landmarks(t *testing.T) {
+	_, result := downloadAs(t, pipeline.FormatEPUB)
+	files := readZip(t, result.Output)
+
+	require.Contains(t, files["OEBPS/cover.xhtml"], `<section epub:type="cover" class="cover"><img src="../cover.jpg" alt="Sole Elite Disclosed"/></section>`)
+
+	nav := files["OEBPS/nav.xhtml"]
+	require.Contains(t, nav, `<nav epub:type="toc" id="toc" role="doc-toc">`)
+	require.Regexp(t, `(?s)<nav epub:type="landmarks" id="landmarks" hidden="hidden">.*`+
+		`<a epub:type="cover" href="cover.xhtml">.*<a epub:type="titlepage" href="title_page.xhtml">.*`+
+		`<a epub:type="toc" href="nav.xhtml#toc">.*<a epub:type="bodymatter" href="chapter_1.xhtml">`, nav)
+
+	// o leitor abre na capa, e o guide do epub 2 aponta para as mesmas páginas
+	opf := files["OEBPS/content.opf"]
+	require.Regexp(t, `<spine toc="ncx">\s*<itemref idref="cover_page"></itemref>`, opf)
+	require.Contains(t, opf, `<meta name="cover" content="cover"></meta>`)
+	require.Regexp(t, `(?s)<guide>\s*<reference type="cover" title="Cover" href="cover.xhtml"></reference>\s*`+
+		`<reference type="title-page" title="Title Page" href="title_page.xhtml"></reference>\s*`+
+		`<reference type="toc" title="Table of Contents" href="nav.xhtml#toc"></reference>\s*`+
+		`<reference type="text" title="Start of Content" href="chapter_1.xhtml"></reference>\s*</guide>`, opf)
+}
+
+func Test_book_landmarksWithoutCover(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Bare", Author: "Nobody"})
+	require.Nil(t, book.AddChapter(3, "Three", "<p>text</p>"))
+
+	var buf bytes.Buffer
+	_, err := book.WriteTo(&buf)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Empty(t, ebook.ValidateZip(r))
+
+	files := map[string]string{}
+	for _, f := range r.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	require.NotContains(t, files, "OEBPS/cover.xhtml")
+	require.NotContains(t, files["OEBPS/nav.xhtml"], `epub:type="cover"`)
+	require.Contains(t, files["OEBPS/nav.xhtml"], `<a epub:type="bodymatter" href="chapter_3.xhtml">`)
+	require.NotContains(t, files["OEBPS/content.opf"], `name="cover"`)
+}
+
+func Test_book_accessibility(t *testing.T) {
+	_, result := downloadAs(t, pipeline.FormatEPUB)
+	files := readZip(t, result.Output)
+
+	opf := files["OEBPS/content.opf"]
+	for _, meta := range []string{
+		`<meta property="schema:accessMode">textual</meta>`,
+		`<meta property="schema:accessMode">visual</meta>`,
+		`<meta property="schema:accessModeSufficient">textual,visual</meta>`,
+		`<meta property="schema:accessibilityFeature">structuralNavigation</meta>`,
+		`<meta property="schema:accessibilityFeature">tableOfContents</meta>`,
+		`<meta property="schema:accessibilityHazard">none</meta>`,
+		`<meta property="schema:accessibilitySummary">`,
+	} {
+		require.Contains(t, opf, meta)
+	}
+	// as imagens do Wattpad não têm descrição, então o livro não pode dizer que tem
+	require.NotContains(t, opf, `<meta property="schema:accessibilityFeature">alternativeText</meta>`)
+
+	// cada capítulo é uma seção com o título num h1, e toda imagem tem alt,
+	// vazio quando não há legenda, pro leitor de tela pular em vez de ler o arquivo
+	chapter := files["OEBPS/chapter_1.xhtml"]
+	require.Contains(t, chapter, `<section epub:type="chapter" role="doc-chapter"><h1>`)
+	require.Regexp(t, `<img[^>]* alt=""`, chapter)
+	img := regexp.MustCompile(`<img[^>]*>`)
+	for name, content := range files {
+		for _, tag := range img.FindAllString(content, -1) {
+			require.Regexpf(t, ` alt="[^"]*"`, tag, "imagem sem alt em '%s'", name)
+		}
+	}
+	require.Contains(t, files["OEBPS/introduction.xhtml"], `epub:type="introduction" role="doc-introduction"`)
+}
+
+func Test_book_describedImages(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Mapa", Author: "Ninguém"})
+	require.Nil(t, book.AddImage(ebook.Image{Name: "mapa.png", Data: []byte("\x89PNG\r\n\x1a\n")}))
+	require.Nil(t, book.AddChapter(1, "Um", `<p>texto</p><img src="../images/mapa.png" alt="O mapa da ilha"/>`))
+
+	var buf bytes.Buffer
+	_, err := book.WriteTo(&buf)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	rc, err := r.Open("OEBPS/content.opf")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+
+	// com toda imagem descrita, o livro pode dizer que tem texto alternativo
+	opf := string(data)
+	require.Contains(t, opf, `<meta property="schema:accessibilityFeature">alternativeText</meta>`)
+	require.Contains(t, opf, `<meta property="schema:accessModeSufficient">textual</meta>`)
+}
+
+func Test_book_language(t *testing.T) {
+	for name, code := range map[string]string{
+		"English":   "en",
+		"Português": "pt",
+		"spanish":   "es",
+		"日本語":       "ja",
+		"pt-BR":     "pt-BR",
+		"":          "en",
+		"Klingon":   "en",
+	} {
+		require.Equalf(t, code, ebook.LanguageCode(name), "o código de '%s'", name)
+	}
+
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Língua", Author: "Ninguém", Language: "Português"})
+	require.Nil(t, book.AddChapter(1, "Um", "<p>texto</p>"))
+
+	var buf bytes.Buffer
+	_, err := book.WriteTo(&buf)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	for _, f := range r.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		switch {
+		case f.Name == "OEBPS/content.opf":
+			require.Contains(t, string(data), "<dc:language>pt</dc:language>")
+		case strings.HasSuffix(f.Name, ".xhtml"):
+			require.Containsf(t, string(data), `lang="pt" xml:lang="pt"`, "'%s' não está em português", f.Name)
+		}
+		// as páginas geradas também são escritas em português
+		switch f.Name {
+		case "OEBPS/title_page.xhtml":
+			require.Contains(t, string(data), "<p>por Ninguém</p>")
+			require.Contains(t, string(data), `<p class="downloaded">Baixado em `)
+		case "OEBPS/introduction.xhtml":
+			require.Contains(t, string(data), "<h2>Introdução</h2>")
+			require.Contains(t, string(data), "<dt>Situação</dt><dd>Em andamento</dd>")
+		case "OEBPS/nav.xhtml":
+			require.Contains(t, string(data), `href="title_page.xhtml">Folha de rosto</a>`)
+		}
+	}
+
+	var page strings.Builder
+	require.Nil(t, book.WriteHTML(&page))
+	require.Contains(t, page.String(), `<html lang="pt">`)
+	require.Contains(t, page.String(), "<h2>Sumário</h2>")
+}
@@ -0,0 +1,80 @@
+package packagetests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"wattpad-to-ebook/fetch"
+	"wattpad-to-ebook/wattpad_stories"
+
+	"github.com/stretchr/testify/require"
+)
+
+// cookieServer answers 200 only to requests carrying the session cookie.
+func cookieServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("token")
+		if err != nil || cookie.Value != "segredo" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("<p>parte só para quem está logado</p>"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func Test_cookies_netscape(t *testing.T) {
+	server := cookieServer(t)
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	cookies := "# Netscape HTTP Cookie File\n" +
+		"#HttpOnly_127.0.0.1\tFALSE\t/\tFALSE\t0\ttoken\tsegredo\n" +
+		"127.0.0.1\tFALSE\t/\tFALSE\t1\tvelho\tjá expirou\n"
+	require.NoError(t, os.WriteFile(path, []byte(cookies), 0o600))
+
+	jar, err := fetch.LoadCookies(path)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	resp, err := fetch.New(fetch.Config{Timeout: 5 * time.Second, Jar: jar}).Get(context.Background(), server.URL)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func Test_cookies_jsonChapterText(t *testing.T) {
+	server := cookieServer(t)
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	cookies := `[{"domain": "127.0.0.1", "hostOnly": true, "name": "token", "value": "segredo", "path": "/", "expirationDate": 4102444800}]`
+	require.NoError(t, os.WriteFile(path, []byte(cookies), 0o600))
+
+	jar, err := fetch.LoadCookies(path)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	oldBase := wattpadstories.BaseURL
+	wattpadstories.BaseURL = server.URL
+	wattpadstories.SetClient(fetch.New(fetch.Config{Timeout: 5 * time.Second, Jar: jar}))
+	t.Cleanup(func() {
+		wattpadstories.BaseURL = oldBase
+		wattpadstories.SetClient(nil)
+	})
+
+	// a página 0 volta sempre a mesma, então o texto para na segunda
+	text, pages, err := wattpadstories.Get_Chapter_Text(context.Background(), server.URL+"/1600000001-logged-in-only")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, 1, pages)
+	require.Contains(t, string(text), "logado")
+}
+
+func Test_cookies_errorsHideValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	require.NoError(t, os.WriteFile(path, []byte("127.0.0.1\tFALSE\t/\tsegredo\n"), 0o600))
+
+	_, err := fetch.LoadCookies(path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "linha 1")
+	require.NotContains(t, err.Error(), "segredo")
+}
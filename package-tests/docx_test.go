@@ -0,0 +1,119 @@
+package packagetests
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"wattpad-to-ebook/docx"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/sources"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/require"
+)
+
+// styled are the paragraphs of body with style.
+func styled(body *etree.Element, style string) []*etree.Element {
+	var paragraphs []*etree.Element
+	for _, p := range body.SelectElements("w:p") {
+		if s := p.FindElement("w:pPr/w:pStyle"); s != nil && s.SelectAttrValue("w:val", "") == style {
+			paragraphs = append(paragraphs, p)
+		}
+	}
+	return paragraphs
+}
+
+func Test_docx_story(t *testing.T) {
+	_, result := downloadAs(t, pipeline.FormatDOCX)
+	require.True(t, strings.HasSuffix(result.Output, ".docx"), "o arquivo tem que terminar em .docx")
+
+	files := readZip(t, result.Output)
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "word/document.xml", "word/styles.xml", "word/_rels/document.xml.rels", "docProps/core.xml"} {
+		require.Containsf(t, files, name, "falta a parte '%s'", name)
+		doc := etree.NewDocument()
+		require.Nilf(t, doc.ReadFromString(files[name]), "a parte '%s' não é XML válido", name)
+	}
+	require.Contains(t, files, "word/media/cover.jpg")
+	require.Contains(t, files, "word/media/chapter1_img0.png")
+	require.Contains(t, (files["docProps/core.xml"]), "<dc:title>Sole Elite Disclosed</dc:title>")
+
+	doc := etree.NewDocument()
+	require.Nil(t, doc.ReadFromString(files["word/document.xml"]))
+	body := doc.FindElement("/w:document/w:body")
+	require.NotNil(t, body)
+
+	// a página de título vem antes, e cada capítulo começa numa página nova
+	require.Equal(t, "Sole Elite Disclosed", styled(body, "Title")[0].FindElement(".//w:t").Text())
+	headings := styled(body, "Heading1")
+	require.Len(t, headings, 2)
+	for _, heading := range headings {
+		require.NotNil(t, heading.FindElement("w:pPr/w:pageBreakBefore"))
+	}
+	require.Equal(t, "Prologue", headings[0].FindElement(".//w:t").Text())
+
+	// toda imagem aponta para uma relação que existe
+	rels := etree.NewDocument()
+	require.Nil(t, rels.ReadFromString(files["word/_rels/document.xml.rels"]))
+	targets := map[string]string{}
+	for _, rel := range rels.FindElements("//Relationship") {
+		targets[rel.SelectAttrValue("Id", "")] = rel.SelectAttrValue("Target", "")
+	}
+	blips := doc.FindElements("//a:blip")
+	require.Len(t, blips, 3)
+	for _, blip := range blips {
+		target, ok := targets[blip.SelectAttrValue("r:embed", "")]
+		require.True(t, ok, "a imagem aponta para uma relação que não existe")
+		require.Contains(t, files, "word/"+target)
+	}
+	require.Contains(t, (files["[Content_Types].xml"]), `<Default Extension="png" ContentType="image/png"/>`)
+}
+
+func Test_docx_omnibus(t *testing.T) {
+	result := omnibusAs(t, pipeline.FormatDOCX)
+
+	doc := etree.NewDocument()
+	require.Nil(t, doc.ReadFromString(readZip(t, result.Output)["word/document.xml"]))
+	body := doc.FindElement("/w:document/w:body")
+	require.NotNil(t, body)
+
+	// cada história é um Título 1, com o autor e a capa logo depois, e as partes um nível abaixo
+	var stories []string
+	for _, heading := range styled(body, "Heading1") {
+		stories = append(stories, heading.FindElement(".//w:t").Text())
+	}
+	require.Equal(t, []string{"Manager's Duties", "Sole Elite Disclosed", "Fallback Story"}, stories)
+	require.Len(t, styled(body, "Heading2"), 7)
+
+	paragraphs := body.SelectElements("w:p")
+	for i, p := range paragraphs {
+		if p.FindElement("w:pPr/w:pStyle[@w:val='Heading1']") == nil {
+			continue
+		}
+		require.True(t, strings.HasPrefix(paragraphs[i+1].FindElement(".//w:t").Text(), "by "), "o autor tem que vir depois do título da história")
+		require.NotNil(t, paragraphs[i+2].FindElement(".//a:blip"), "a capa da história tem que vir depois do autor")
+	}
+}
+
+func Test_docx_markup(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Marks", Author: "Nobody"})
+	err := book.AddChapter(1, "One", `<p style="text-align:center">mid</p><p align="right">end</p><p style="text-align: justify">full</p>
+		<p>a <b>b</b> <i>c</i><br>d <a href="https://example.com">out</a> <a href="chapter_2.xhtml">two</a></p>`)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Nil(t, book.AddChapter(2, "Two", `<p>back</p>`))
+
+	name := filepath.Join(t.TempDir(), "marks.docx")
+	require.Nil(t, docx.WriteFile(name, book))
+	files := readZip(t, name)
+	document := files["word/document.xml"]
+
+	require.Contains(t, document, `<w:p><w:pPr><w:jc w:val="center"/></w:pPr><w:r><w:t xml:space="preserve">mid</w:t></w:r></w:p>`)
+	require.Contains(t, document, `<w:jc w:val="right"/>`)
+	require.Contains(t, document, `<w:jc w:val="both"/>`)
+	require.Contains(t, document, `<w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">b</w:t></w:r>`)
+	require.Contains(t, document, `<w:r><w:rPr><w:i/></w:rPr><w:t xml:space="preserve">c</w:t></w:r>`)
+	require.Contains(t, document, `<w:br/><w:t xml:space="preserve">d </w:t>`)
+	require.Contains(t, document, `<w:hyperlink w:anchor="chapter_2">`)
+	require.Contains(t, document, `<w:bookmarkStart w:id="2" w:name="chapter_2"/>`)
+	require.Contains(t, (files["word/_rels/document.xml.rels"]), `Target="https://example.com" TargetMode="External"`)
+}
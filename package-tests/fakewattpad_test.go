@@ -0,0 +1,203 @@
+package packagetests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"wattpad-to-ebook/fetch"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/wattpad_stories"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWattpad stands in for www.wattpad.com using the responses saved in
+// testdata/wattpad:
+//
+//	/api/v3/stories/<id>          stories/<id>.json
+//	/story/<id>-<slug>            stories/<id>.html
+//	/apiv2/?m=storytext&id=&page= storytext/<id>_<page>.html (empty when missing)
+//	/images/<name>                images/<name>
+//	/api/v3/lists/<id>            lists/<id>.json
+//	/api/v3/lists/<id>/stories    lists/<id>_stories_<offset>.json
+//	/api/v3/users/<name>/stories/published users/<name>_<offset>.json
+//
+// "{{BASE}}" inside the json and html fixtures is replaced by the server url,
+// so the links in them point back at the fake.
+type fakeWattpad struct {
+	*httptest.Server
+	dir string
+
+	mu      sync.Mutex
+	parts   map[string]bool // ids asked to the storytext api
+	stories int             // requests to the story api and story pages
+}
+
+func newFakeWattpad(t *testing.T) *fakeWattpad {
+	t.Helper()
+
+	f := &fakeWattpad{dir: filepath.Join("testdata", "wattpad"), parts: map[string]bool{}}
+	f.dir, _ = filepath.Abs(f.dir)
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+
+	oldBase := wattpadstories.BaseURL
+	wattpadstories.BaseURL = f.URL
+	client := fetch.New(fetch.Config{Timeout: 5 * time.Second, MaxRetries: 1, BaseDelay: time.Millisecond})
+	wattpadstories.SetClient(client)
+	// the images are downloaded with the shared client, whatever the source
+	oldDefault := fetch.Default()
+	fetch.SetDefault(client)
+
+	t.Cleanup(func() {
+		f.Close()
+		wattpadstories.BaseURL = oldBase
+		wattpadstories.SetClient(nil)
+		fetch.SetDefault(oldDefault)
+	})
+	return f
+}
+
+// wattpadBase returns the fake server url, or the real site when WATTPAD_LIVE
+// is set, for the tests that make sense against both.
+func wattpadBase(t *testing.T) string {
+	if os.Getenv("WATTPAD_LIVE") != "" {
+		return "https://www.wattpad.com"
+	}
+	return newFakeWattpad(t).URL
+}
+
+// soleElite is the story of the fixtures with a cover and images, the one
+// the writers are tested with.
+const soleElite = "/story/388706112-sole-elite-disclosed"
+
+// downloadAs downloads soleElite from a fake Wattpad in format, into a
+// temporary directory the test is moved to.
+func downloadAs(t *testing.T, format pipeline.Format) (*fakeWattpad, pipeline.Result) {
+	t.Helper()
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	result, err := pipeline.Download(context.Background(), wattpadstories.Wattpad{}, fake.URL+soleElite, nil, pipeline.Options{Concurrency: 2, Format: format})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	return fake, result
+}
+
+// omnibusAs puts the three stories of the list 900000001-club-picks in a
+// single book in format, like downloadAs. The second one is soleElite.
+func omnibusAs(t *testing.T, format pipeline.Format) pipeline.Result {
+	t.Helper()
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	list, err := wattpadstories.Wattpad{}.List(context.Background(), fake.URL+"/list/900000001-club-picks")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	result, err := pipeline.Omnibus(context.Background(), list, pipeline.Options{Concurrency: 2, Format: format})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	return result
+}
+
+// storyRequests is how many times the story api or a story page was asked for.
+func (f *fakeWattpad) storyRequests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stories
+}
+
+// fetchedParts returns the ids of the parts whose text was requested.
+func (f *fakeWattpad) fetchedParts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := []string{}
+	for id := range f.parts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (f *fakeWattpad) serve(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/v3/stories/"):
+		f.countStory()
+		f.file(w, "stories", path.Base(r.URL.Path)+".json", true)
+
+	case strings.HasPrefix(r.URL.Path, "/api/v3/lists/"):
+		id, stories, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v3/lists/"), "/")
+		if stories == "stories" {
+			f.file(w, "lists", id+"_stories_"+offset(r)+".json", true)
+			return
+		}
+		f.file(w, "lists", id+".json", true)
+
+	case strings.HasPrefix(r.URL.Path, "/api/v3/users/") && strings.HasSuffix(r.URL.Path, "/stories/published"):
+		name := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v3/users/"), "/")[0]
+		f.file(w, "users", name+"_"+offset(r)+".json", true)
+
+	case strings.HasPrefix(r.URL.Path, "/story/"):
+		f.countStory()
+		id := strings.Split(path.Base(r.URL.Path), "-")[0]
+		f.file(w, "stories", id+".html", true)
+
+	case r.URL.Path == "/apiv2/" && r.URL.Query().Get("m") == "storytext":
+		f.mu.Lock()
+		f.parts[r.URL.Query().Get("id")] = true
+		f.mu.Unlock()
+
+		name := r.URL.Query().Get("id") + "_" + r.URL.Query().Get("page") + ".html"
+		if _, err := os.Stat(filepath.Join(f.dir, "storytext", name)); err != nil {
+			// the real api answers past the last page with an empty body
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		f.file(w, "storytext", name, true)
+
+	case strings.HasPrefix(r.URL.Path, "/images/"):
+		f.file(w, "images", path.Base(r.URL.Path), false)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeWattpad) countStory() {
+	f.mu.Lock()
+	f.stories++
+	f.mu.Unlock()
+}
+
+// offset is the page of a list asked for, "0" when missing.
+func offset(r *http.Request) string {
+	if value := r.URL.Query().Get("offset"); value != "" {
+		return value
+	}
+	return "0"
+}
+
+func (f *fakeWattpad) file(w http.ResponseWriter, folder string, name string, template bool) {
+	content, err := os.ReadFile(filepath.Join(f.dir, folder, name))
+	if err != nil {
+		http.NotFound(w, nil)
+		return
+	}
+
+	if template {
+		content = bytes.ReplaceAll(content, []byte("{{BASE}}"), []byte(f.URL))
+	}
+
+	switch filepath.Ext(name) {
+	case ".json":
+		w.Header().Set("Content-Type", "application/json")
+	case ".html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	w.Write(content)
+}
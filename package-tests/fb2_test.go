@@ -0,0 +1,117 @@
+package packagetests
+
+import (
+	"archive/zip"
+	"strings"
+	"testing"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/fb2"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/sources"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_fb2_story(t *testing.T) {
+	_, result := downloadAs(t, pipeline.FormatFB2)
+	require.True(t, strings.HasSuffix(result.Output, ".fb2"), "o arquivo tem que terminar em .fb2")
+
+	doc := etree.NewDocument()
+	require.Nil(t, doc.ReadFromFile(result.Output))
+
+	info := doc.FindElement("/FictionBook/description/title-info")
+	require.NotNil(t, info)
+	require.Equal(t, "Sole Elite Disclosed", info.FindElement("book-title").Text())
+	require.NotEmpty(t, info.FindElement("author/nickname").Text())
+	require.NotNil(t, info.FindElement("annotation/p"))
+	cover := info.FindElement("coverpage/image").SelectAttrValue("l:href", "")
+	require.Equal(t, "#cover.jpg", cover)
+
+	sections := doc.FindElements("/FictionBook/body/section")
+	require.Len(t, sections, 2)
+	require.Equal(t, "Prologue", sections[0].FindElement("title/p").Text())
+	require.Equal(t, "Chapter 1: Class D", sections[1].FindElement("title/p").Text())
+
+	// toda imagem citada tem o seu binary, e só as citadas estão no arquivo
+	binaries := map[string]bool{}
+	for _, bin := range doc.FindElements("/FictionBook/binary") {
+		binaries[bin.SelectAttrValue("id", "")] = true
+	}
+	hrefs := map[string]bool{"cover.jpg": true}
+	for _, img := range doc.FindElements("//section//image") {
+		href := img.SelectAttrValue("l:href", "")
+		require.True(t, strings.HasPrefix(href, "#"))
+		hrefs[href[1:]] = true
+	}
+	require.Equal(t, hrefs, binaries)
+	require.True(t, binaries["chapter1_img0.png"])
+}
+
+func Test_fb2_zip(t *testing.T) {
+	_, result := downloadAs(t, pipeline.FormatFB2Zip)
+	require.True(t, strings.HasSuffix(result.Output, ".fb2.zip"), "o arquivo tem que terminar em .fb2.zip")
+
+	archive, err := zip.OpenReader(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	defer archive.Close()
+	require.Len(t, archive.File, 1)
+	require.True(t, strings.HasSuffix(archive.File[0].Name, ".fb2"))
+
+	f, err := archive.File[0].Open()
+	require.Nil(t, err)
+	defer f.Close()
+	doc := etree.NewDocument()
+	_, err = doc.ReadFrom(f)
+	require.Nil(t, err)
+	require.Equal(t, "Sole Elite Disclosed", doc.FindElement("//book-title").Text())
+}
+
+func Test_fb2_omnibus(t *testing.T) {
+	result := omnibusAs(t, pipeline.FormatFB2)
+
+	doc := etree.NewDocument()
+	require.Nil(t, doc.ReadFromFile(result.Output))
+	stories := doc.FindElements("/FictionBook/body/section")
+	require.Len(t, stories, 3)
+
+	// antes das seções de dentro só pode vir title, epigraph, image e annotation, nessa ordem
+	order := map[string]int{"title": 1, "epigraph": 2, "image": 3, "annotation": 4}
+	for _, story := range stories {
+		last, inner := 0, false
+		for _, child := range story.ChildElements() {
+			if child.Tag == "section" {
+				inner = true
+				continue
+			}
+			require.Falsef(t, inner, "<%s> depois das seções de '%s'", child.Tag, story.FindElement("title/p").Text())
+			require.Containsf(t, order, child.Tag, "<%s> não pode vir antes das seções", child.Tag)
+			require.Greaterf(t, order[child.Tag], last, "<%s> fora de ordem", child.Tag)
+			last = order[child.Tag]
+		}
+		require.True(t, inner, "a história tinha que ter as partes dentro dela")
+	}
+
+	second := stories[1]
+	require.Equal(t, "Sole Elite Disclosed", second.FindElement("title/p").Text())
+	require.Equal(t, "#story2_cover.jpg", second.FindElement("image").SelectAttrValue("l:href", ""))
+	require.Equal(t, "by cote_fan", second.FindElement("annotation/p").Text())
+	require.NotNil(t, doc.FindElement("/FictionBook/binary[@id='story2_cover.jpg']"))
+}
+
+func Test_fb2_markup(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Marks", Author: "Nobody"})
+	err := book.AddChapter(1, "One", `<p>a<b>b</b> <i>c <a href="https://example.com">d</a></i><br>e</p><hr><blockquote><p>q</p></blockquote>`)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Nil(t, book.AddChapter(2, "Two", ``))
+
+	var out strings.Builder
+	require.Nil(t, fb2.Write(&out, book))
+
+	// a indentação não pode mudar o texto dos parágrafos
+	require.Contains(t, out.String(), `<p>a<strong>b</strong> <emphasis>c </emphasis><a l:href="https://example.com"><emphasis>d</emphasis></a></p>`)
+	require.Contains(t, out.String(), "<p>e</p>")
+	require.Contains(t, out.String(), "<subtitle>* * *</subtitle>")
+	require.Contains(t, out.String(), "<cite>\n")
+	require.Contains(t, out.String(), "<empty-line/>")
+}
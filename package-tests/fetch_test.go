@@ -0,0 +1,117 @@
+package packagetests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wattpad-to-ebook/fetch"
+	"wattpad-to-ebook/wattpad_stories"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testClient() *fetch.Client {
+	return fetch.New(fetch.Config{Timeout: 5 * time.Second, MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+}
+
+func Test_fetch_retriesTooManyRequests(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	resp, err := testClient().Get(context.Background(), server.URL)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(3), calls.Load(), "era para ter tentado 3 vezes")
+}
+
+func Test_fetch_givesUpOnServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	_, err := testClient().Get(context.Background(), server.URL)
+	var status *fetch.StatusError
+	require.ErrorAs(t, err, &status)
+	require.Equal(t, http.StatusBadGateway, status.StatusCode)
+	require.Equal(t, int32(4), calls.Load(), "era para ter tentado 1 vez e repetido 3")
+}
+
+func Test_fetch_doesNotRetryNotFound(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	resp, err := testClient().Get(context.Background(), server.URL)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func Test_fetch_chapterStopsWhenCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	oldBase := wattpadstories.BaseURL
+	wattpadstories.BaseURL = server.URL
+	wattpadstories.SetClient(testClient())
+	t.Cleanup(func() {
+		wattpadstories.BaseURL = oldBase
+		wattpadstories.SetClient(nil)
+	})
+
+	// outra parte falhou: a que está esperando para tentar de novo desiste na hora
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := wattpadstories.Get_Chapter_Text(ctx, server.URL+"/1600000001-slow-part")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second, "era para ter parado quando o contexto foi cancelado")
+}
+
+func Test_fetch_storyAndListStopWhenCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	oldBase := wattpadstories.BaseURL
+	wattpadstories.BaseURL = server.URL
+	wattpadstories.SetClient(testClient())
+	t.Cleanup(func() {
+		wattpadstories.BaseURL = oldBase
+		wattpadstories.SetClient(nil)
+	})
+
+	// o Ctrl-C também interrompe a leitura da história e das páginas de uma lista
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := wattpadstories.Wattpad{}.Story(ctx, server.URL+"/story/1600000002-slow-story")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = wattpadstories.Wattpad{}.List(ctx, server.URL+"/list/1600000003-slow-list")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second, "era para ter parado quando o contexto foi cancelado")
+}
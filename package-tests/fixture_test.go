@@ -0,0 +1,192 @@
+package packagetests
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/wattpad_stories"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_fixture_chapterPages(t *testing.T) {
+	fake := newFakeWattpad(t)
+
+	text, pages, err := wattpadstories.Get_Chapter_Text(context.Background(), fake.URL+"/1512000102-managers-duties-the-long-meeting")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, 3, pages, "a parte tem 3 páginas nos fixtures")
+
+	for _, id := range []string{"b1", "b2", "b3", "b4", "b5"} {
+		require.Containsf(t, string(text), `data-p-id="`+id+`"`, "o parágrafo %s ficou de fora", id)
+	}
+}
+
+func Test_fixture_storyJSON(t *testing.T) {
+	fake := newFakeWattpad(t)
+
+	chapters, metadata, err := wattpadstories.Get_Chapters(context.Background(), fake.URL+"/story/389173089-manager%27s-duties")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	require.Equal(t, "389173089", metadata.ID)
+	require.Equal(t, "Manager's Duties", metadata.Name)
+	require.Equal(t, "quietwriter", metadata.Author)
+	require.Equal(t, []string{"office", "slice-of-life", "shortstory"}, metadata.Tags)
+	require.Equal(t, "English", metadata.Language)
+	require.True(t, metadata.Completed)
+	require.Equal(t, "image/jpeg", metadata.CoverImageType)
+	require.NotEmpty(t, metadata.CoverImage)
+
+	require.Len(t, chapters, 3)
+	require.Equal(t, "1512000102", chapters[1].ID)
+	require.Equal(t, 2, chapters[1].Index)
+	require.Equal(t, "The Long Meeting", chapters[1].Title)
+}
+
+func Test_fixture_storyFetchedOnce(t *testing.T) {
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	// os metadados e as partes vêm da mesma chamada à api
+	_, err := pipeline.Download(context.Background(), wattpadstories.Wattpad{}, fake.URL+"/story/389173089-manager%27s-duties", nil, pipeline.Options{Concurrency: 2})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, 1, fake.storyRequests())
+}
+
+func Test_fixture_htmlFallback(t *testing.T) {
+	fake := newFakeWattpad(t)
+
+	// não tem json para essa história, só a página
+	metadata, chapters, err := wattpadstories.Wattpad{}.Story(context.Background(), fake.URL+"/story/300000001-fallback-story")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	// uma chamada à api e uma à página, e não duas de cada
+	require.Equal(t, 2, fake.storyRequests())
+
+	require.Equal(t, "300000001", metadata.ID)
+	require.Equal(t, "Fallback Story", metadata.Name)
+	require.Equal(t, "htmlonly", metadata.Author)
+	require.Len(t, chapters, 2)
+	require.Equal(t, "Second", chapters[1].Title)
+	require.Equal(t, "1514000302", chapters[1].ID)
+}
+
+func Test_fixture_coverUnavailable(t *testing.T) {
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	// a capa dá 404, e o livro sai sem capa em vez de dar erro
+	result, err := pipeline.Download(context.Background(), wattpadstories.Wattpad{}, fake.URL+"/story/500000001-lost-cover", nil, pipeline.Options{Concurrency: 2})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	epub, err := zip.OpenReader(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	defer epub.Close()
+	for _, f := range epub.File {
+		require.NotEqualf(t, "cover.jpg", f.Name, "a capa que não baixou não era para estar no epub")
+	}
+
+	// na página html sem capa a url fica vazia e nada é baixado
+	metadata, _, err := wattpadstories.Wattpad{}.Story(context.Background(), fake.URL+"/story/300000002-coverless-story")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, "Coverless Story", metadata.Name)
+	require.Empty(t, metadata.CoverImage)
+	require.Empty(t, metadata.CoverImageType)
+}
+
+func Test_fixture_bothPathsFail(t *testing.T) {
+	fake := newFakeWattpad(t)
+
+	_, _, err := wattpadstories.Get_Chapters(context.Background(), fake.URL+"/story/123-does-not-exist")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "api json")
+	require.Contains(t, err.Error(), "página html")
+}
+
+func Test_fixture_pipeline(t *testing.T) {
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	result, err := pipeline.Download(context.Background(), wattpadstories.Wattpad{}, fake.URL+"/story/388706112-sole-elite-disclosed", nil, pipeline.Options{Concurrency: 3})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, "Sole Elite Disclosed - cote_fan.epub", result.Output)
+	require.Empty(t, result.Paywalled)
+	epubName := result.Output
+
+	epub, err := zip.OpenReader(epubName)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	defer epub.Close()
+
+	files := map[string]*zip.File{}
+	for _, f := range epub.File {
+		files[f.Name] = f
+	}
+
+	for _, name := range []string{"mimetype", "META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/toc.ncx", "OEBPS/chapter_1.xhtml", "OEBPS/chapter_2.xhtml", "cover.jpg", "images/chapter1_img0.png", "images/chapter2_img0.jpg"} {
+		require.Containsf(t, files, name, "era para o epub ter '%s', mas não tem", name)
+	}
+
+	// a imagem que dá 404 fica de fora, sem derrubar o capítulo
+	for name := range files {
+		require.Falsef(t, strings.HasPrefix(name, "images/chapter2_img1"), "a imagem quebrada não era para estar no epub: %s", name)
+	}
+}
+
+func Test_fixture_validate(t *testing.T) {
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	for _, story := range []string{"/story/388706112-sole-elite-disclosed", "/story/389173089-manager%27s-duties"} {
+		result, err := pipeline.Download(context.Background(), wattpadstories.Wattpad{}, fake.URL+story, nil, pipeline.Options{Concurrency: 2})
+		require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+		findings, err := ebook.Validate(result.Output)
+		require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+		require.Emptyf(t, findings, "o epub '%s' não passou na validação: %v", result.Output, findings)
+	}
+}
+
+func Test_fixture_paywalled(t *testing.T) {
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+	story := fake.URL + "/story/400000001-paid-hours"
+
+	// a parte 2 vem marcada pela api, a 3 só é descoberta porque vem vazia
+	result, err := pipeline.Download(context.Background(), wattpadstories.Wattpad{}, story, nil, pipeline.Options{Concurrency: 2, Output: "placeholder.epub"})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Len(t, result.Paywalled, 2)
+	require.Equal(t, "1515000402", result.Paywalled[0].ID)
+	require.Equal(t, "1515000403", result.Paywalled[1].ID)
+
+	findings, err := ebook.Validate(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Emptyf(t, findings, "o epub não passou na validação: %v", findings)
+
+	epub, err := zip.OpenReader(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	defer epub.Close()
+
+	chapter, err := epub.Open("OEBPS/chapter_3.xhtml")
+	require.Nilf(t, err, "era para a parte paga ter uma página no lugar, mas não tem: %v", err)
+	body, _ := io.ReadAll(chapter)
+	chapter.Close()
+	require.Contains(t, string(body), "paywalled")
+
+	result, err = pipeline.Download(context.Background(), wattpadstories.Wattpad{}, story, nil, pipeline.Options{Concurrency: 2, Output: "skip.epub", Paywalled: pipeline.PaywallSkip})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Len(t, result.Paywalled, 2)
+
+	book, err := zip.OpenReader(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	defer book.Close()
+	for _, f := range book.File {
+		require.Falsef(t, f.Name == "OEBPS/chapter_2.xhtml" || f.Name == "OEBPS/chapter_3.xhtml", "a parte paga não era para estar no epub: %s", f.Name)
+	}
+
+	_, err = pipeline.Download(context.Background(), wattpadstories.Wattpad{}, story, nil, pipeline.Options{Concurrency: 2, Output: "abort.epub", Paywalled: pipeline.PaywallAbort})
+	var paywalled *pipeline.PaywalledError
+	require.ErrorAs(t, err, &paywalled)
+	require.NoFileExists(t, "abort.epub")
+}
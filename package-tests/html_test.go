@@ -0,0 +1,82 @@
+package packagetests
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/sources"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func Test_html_story(t *testing.T) {
+	_, result := downloadAs(t, pipeline.FormatHTML)
+	require.Equal(t, ".html", filepath.Ext(result.Output))
+
+	data, err := os.ReadFile(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	page := string(data)
+
+	_, err = html.Parse(strings.NewReader(page))
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	// a capa, o bloco de metadados e o sumário vêm antes dos capítulos
+	cover := strings.Index(page, `<img class="cover" src="data:image/jpeg;base64,`)
+	metadata := strings.Index(page, `<header class="metadata">`)
+	toc := strings.Index(page, `<nav id="toc">`)
+	chapter := strings.Index(page, `<section id="chapter_1" class="chapter">`)
+	require.True(t, cover >= 0 && cover < metadata && metadata < toc && toc < chapter, "a ordem da página está errada")
+
+	require.Contains(t, page, `<li><a href="#chapter_1">Prologue</a></li>`)
+	require.Contains(t, page, `<section id="chapter_2" class="chapter">`)
+	require.Contains(t, page, "font-family: Verdana")
+
+	// nenhuma imagem fica de fora da página
+	for _, src := range regexp.MustCompile(`<img[^>]* src="([^"]*)"`).FindAllStringSubmatch(page, -1) {
+		if !strings.Contains(src[1], "missing.jpg") {
+			require.Truef(t, strings.HasPrefix(src[1], "data:image/"), "a imagem '%.40s' não está dentro da página", src[1])
+		}
+	}
+	require.Contains(t, page, `src="data:image/png;base64,`)
+}
+
+func Test_html_omnibus(t *testing.T) {
+	result := omnibusAs(t, pipeline.FormatHTML)
+
+	data, err := os.ReadFile(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	page := string(data)
+	_, err = html.Parse(strings.NewReader(page))
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	// cada história tem a sua seção com o autor e a capa, seguida das partes dela
+	story := strings.Index(page, `<section id="story_2" class="story">`)
+	prologue := strings.Index(page, `<section id="story2_chapter_1" class="chapter">`)
+	next := strings.Index(page, `<section id="story_3" class="story">`)
+	require.True(t, story >= 0 && story < prologue && prologue < next, "as partes têm que vir depois da história delas")
+	require.Contains(t, page[story:prologue], "<p>by cote_fan</p>")
+	require.Contains(t, page[story:prologue], `src="data:image/jpeg;base64,`)
+
+	// no sumário as partes ficam dentro da história
+	require.Regexp(t, `<li><a href="#story_2">Sole Elite Disclosed</a>\s*<ol>\s*<li><a href="#story2_chapter_1">Prologue</a>`, page)
+}
+
+func Test_html_links(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Links <&>", Author: "Nobody", Tags: []string{"x"}, Completed: true})
+	require.Nil(t, book.AddChapter(1, "One", `<p>Go to <a href="chapter_2.xhtml#top">two</a> or <a href="https://example.com/a.xhtml">out</a></p>`))
+	require.Nil(t, book.AddChapter(2, "Two", `<p>back</p>`))
+
+	var page strings.Builder
+	require.Nil(t, book.WriteHTML(&page))
+
+	require.Contains(t, page.String(), "<title>Links &lt;&amp;&gt;</title>")
+	require.Contains(t, page.String(), `<a href="#chapter_2">two</a>`)
+	require.Contains(t, page.String(), `<a href="https://example.com/a.xhtml">out</a>`)
+	require.Contains(t, page.String(), "<dt>Status</dt><dd>Completed</dd>")
+	require.NotContains(t, page.String(), `class="cover"`)
+}
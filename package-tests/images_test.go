@@ -0,0 +1,32 @@
+package packagetests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wattpad-to-ebook/fetch"
+	"wattpad-to-ebook/images"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_images_anySite(t *testing.T) {
+	// um site qualquer, que não é o Wattpad
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata/wattpad/images")))
+	defer server.Close()
+	oldDefault := fetch.Default()
+	fetch.SetDefault(testClient())
+	defer fetch.SetDefault(oldDefault)
+
+	body := `<p>a</p><img src="` + server.URL + `/classroom.png" data-caption="The classroom"><img src="` + server.URL + `/gone.png">`
+	html, found, err := images.DownloadAndRewrite(context.Background(), []byte(body), 3, 2)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	// só a imagem que existe entra no livro, e a outra fica com o endereço original
+	require.Len(t, found, 1)
+	require.Equal(t, "chapter3_img0.png", found[0].Name)
+	require.Equal(t, "image/png", found[0].MediaType)
+	require.Contains(t, html, `<img src="../images/chapter3_img0.png" data-caption="The classroom" alt="The classroom" width="100%"/>`)
+	require.Contains(t, html, `src="`+server.URL+`/gone.png" alt=""`)
+}
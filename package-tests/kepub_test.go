@@ -0,0 +1,115 @@
+package packagetests
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/sources"
+	"wattpad-to-ebook/wattpad_stories"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readZip returns every file of the zip at name by its path.
+func readZip(t *testing.T, name string) map[string]string {
+	archive, err := zip.OpenReader(name)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	defer archive.Close()
+
+	files := map[string]string{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+		data, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+	return files
+}
+
+var tags = regexp.MustCompile(`<[^>]+>|\s+`)
+
+// bodyText is the text of the body of an XHTML page, without tags or spaces.
+func bodyText(page string) string {
+	_, body, _ := strings.Cut(page, "<body>")
+	return tags.ReplaceAllString(body, "")
+}
+
+func Test_kepub_story(t *testing.T) {
+	fake, kobo := downloadAs(t, pipeline.FormatKEPUB)
+	plain, err := pipeline.Download(context.Background(), wattpadstories.Wattpad{}, fake.URL+soleElite, nil, pipeline.Options{Concurrency: 2})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.True(t, strings.HasSuffix(kobo.Output, ".kepub.epub"), "o kepub tem que terminar em .kepub.epub")
+
+	findings, err := ebook.Validate(kobo.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Emptyf(t, findings, "o kepub não passou na validação: %v", findings)
+
+	before, after := readZip(t, plain.Output), readZip(t, kobo.Output)
+	require.Equal(t, len(before), len(after), "o kepub tem que ter os mesmos arquivos do epub")
+
+	for name, page := range after {
+		// as páginas do livro mudam, a title page e a introdução também
+		if !strings.HasSuffix(name, ".xhtml") || strings.HasSuffix(name, "nav.xhtml") {
+			require.Equalf(t, before[name], page, "'%s' não era para mudar no kepub", name)
+			continue
+		}
+
+		require.Contains(t, page, `<style type="text/css" id="kobostylehacks">`)
+		require.Regexp(t, `<body>\s*<div id="book-columns"><div id="book-inner">`, page)
+		// só a marcação muda, o texto continua igual
+		require.Equal(t, bodyText(before[name]), bodyText(page))
+
+		ids := regexp.MustCompile(`<span class="koboSpan" id="(kobo\.\d+\.\d+)">`).FindAllStringSubmatch(page, -1)
+		require.NotEmpty(t, ids)
+		require.Equal(t, "kobo.1.1", ids[0][1])
+		seen := map[string]bool{}
+		for _, id := range ids {
+			require.Falsef(t, seen[id[1]], "o id '%s' aparece duas vezes", id[1])
+			seen[id[1]] = true
+		}
+	}
+
+	// as imagens também vão dentro de um span, logo depois do título do capítulo
+	require.Regexp(t, `<h1><span class="koboSpan" id="kobo\.1\.1">Prologue</span></h1>`, after["OEBPS/chapter_1.xhtml"])
+	require.Regexp(t, `<span class="koboSpan" id="kobo\.2\.1"><img src="../images/chapter1_img0.png"`, after["OEBPS/chapter_1.xhtml"])
+}
+
+func Test_kepub_omnibus(t *testing.T) {
+	result := omnibusAs(t, pipeline.FormatKEPUB)
+	require.True(t, strings.HasSuffix(result.Output, ".kepub.epub"), "o kepub tem que terminar em .kepub.epub")
+
+	findings, err := ebook.Validate(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Emptyf(t, findings, "o kepub não passou na validação: %v", findings)
+
+	// a página de título de cada história também é convertida, uma vez só
+	files := readZip(t, result.Output)
+	story := files["OEBPS/story_2.xhtml"]
+	require.Contains(t, story, `<h1><span class="koboSpan" id="kobo.1.1">Sole Elite Disclosed</span></h1>`)
+	require.Equal(t, 1, strings.Count(story, `id="book-columns"`))
+	require.Contains(t, files["OEBPS/story2_chapter_1.xhtml"], `<h1><span class="koboSpan" id="kobo.1.1">Prologue</span></h1>`)
+}
+
+func Test_kepub_sentences(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Kobo", Author: "Nobody"})
+	err := book.AddChapter(1, "One", `<p>First one. "Second!" Third?</p><p>Also <i>styled. Text</i> here</p>`)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Nil(t, book.Kepub())
+	// converter duas vezes não muda nada
+	require.Nil(t, book.Kepub())
+
+	name := t.TempDir() + "/book.kepub.epub"
+	require.Nil(t, book.WriteFile(name))
+	page := readZip(t, name)["OEBPS/chapter_1.xhtml"]
+
+	// o título do capítulo é o primeiro parágrafo
+	require.Contains(t, page, `<h1><span class="koboSpan" id="kobo.1.1">One</span></h1>`)
+	require.Contains(t, page, `<span class="koboSpan" id="kobo.2.1">First one. </span><span class="koboSpan" id="kobo.2.2">"Second!" </span><span class="koboSpan" id="kobo.2.3">Third?</span>`)
+	require.Regexp(t, `<span class="koboSpan" id="kobo.3.1">Also</span>\s*<i>\s*<span class="koboSpan" id="kobo.3.2">styled. </span><span class="koboSpan" id="kobo.3.3">Text</span>\s*</i>\s*<span class="koboSpan" id="kobo.3.4">here</span>`, page)
+}
@@ -0,0 +1,194 @@
+package packagetests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"wattpad-to-ebook/library"
+	"wattpad-to-ebook/pdf"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/sources"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource serves a story from memory, so the library can be tested offline.
+type fakeSource struct {
+	chapters []sources.Story_Chapters
+	texts    map[string]string
+
+	mu      sync.Mutex
+	fetched []string
+}
+
+func (f *fakeSource) Name() string { return "fake" }
+
+func (f *fakeSource) Match(url string) bool { return true }
+
+func (f *fakeSource) Story(ctx context.Context, url string) (sources.Story_Metadata, []sources.Story_Chapters, error) {
+	metadata := sources.Story_Metadata{ID: "42", Name: "Fake Story", Author: "Someone", CoverImageType: "image/png"}
+	return metadata, append([]sources.Story_Chapters{}, f.chapters...), nil
+}
+
+func (f *fakeSource) ChapterHTML(ctx context.Context, chapter sources.Story_Chapters) ([]byte, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetched = append(f.fetched, chapter.ID)
+	return []byte(f.texts[chapter.ID]), 1, nil
+}
+
+func (f *fakeSource) setChapters(ids ...string) {
+	f.chapters = nil
+	for i, id := range ids {
+		f.chapters = append(f.chapters, sources.Story_Chapters{ID: id, Index: i + 1, Title: "Part " + id, URL: "https://example.com/" + id})
+	}
+}
+
+func Test_library_update(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	src := &fakeSource{texts: map[string]string{}}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		src.texts[id] = fmt.Sprintf("<p>texto da parte %s</p>", id)
+	}
+	src.setChapters("a", "b", "c")
+
+	lib, err := library.Open(t.TempDir())
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	result, err := pipeline.Download(context.Background(), src, "https://example.com/story", lib, pipeline.Options{Concurrency: 2})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.FileExists(t, result.Output, "era para o epub ter sido criado, mas não foi")
+
+	story, ok := lib.Get(library.Key("fake", "42"))
+	require.True(t, ok, "era para a história estar na biblioteca, mas não está")
+	require.Len(t, story.Chapters, 3)
+
+	// nada mudou: nenhuma parte deve ser baixada de novo
+	src.fetched = nil
+	result, err = pipeline.Update(context.Background(), src, lib, story, pipeline.Options{Concurrency: 2})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.True(t, result.Changes.Empty(), "não era para ter mudanças, mas tem: %+v", result.Changes)
+	require.Empty(t, src.fetched)
+
+	// "b" saiu, "d" entrou e "c" foi editada
+	src.setChapters("a", "c", "d")
+	src.texts["c"] = "<p>texto novo da parte c</p>"
+	src.fetched = nil
+
+	result, err = pipeline.Update(context.Background(), src, lib, story, pipeline.Options{Concurrency: 2, Recheck: true})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, []string{"d"}, chapterIDs(result.Changes.Added))
+	require.Equal(t, []string{"b"}, chapterIDs(result.Changes.Removed))
+	require.Equal(t, []string{"c"}, chapterIDs(result.Changes.Edited))
+
+	reopened, err := library.Open(lib.Dir())
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	story, ok = reopened.Get(library.Key("fake", "42"))
+	require.True(t, ok, "era para a história estar na biblioteca, mas não está")
+	require.Equal(t, []string{"a", "c", "d"}, chapterIDs(story.Chapters))
+
+	text, err := reopened.ChapterText(story.Key, "c")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, src.texts["c"], string(text))
+
+	_, err = os.Stat(story.OutputPath)
+	require.Nilf(t, err, "era para o epub atualizado existir, mas não existe: %v", err)
+}
+
+func Test_library_paywalledUnlocked(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	src := &fakeSource{texts: map[string]string{"a": "<p>texto da parte a</p>", "b": "  "}}
+	src.setChapters("a", "b")
+
+	lib, err := library.Open(t.TempDir())
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	result, err := pipeline.Download(context.Background(), src, "https://example.com/story", lib, pipeline.Options{Concurrency: 2})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Len(t, result.Paywalled, 1)
+
+	story, ok := lib.Get(library.Key("fake", "42"))
+	require.True(t, ok, "era para a história estar na biblioteca, mas não está")
+	require.True(t, story.Chapters[1].Locked, "a parte vazia devia estar marcada como paga")
+
+	// a parte foi comprada: mesmo sem -recheck ela tem que ser baixada de novo
+	src.texts["b"] = "<p>texto da parte b</p>"
+	src.fetched = nil
+
+	result, err = pipeline.Update(context.Background(), src, lib, story, pipeline.Options{Concurrency: 2})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, []string{"b"}, src.fetched)
+	require.Equal(t, []string{"b"}, chapterIDs(result.Changes.Edited))
+	require.Empty(t, result.Paywalled)
+}
+
+func Test_library_keepsSelection(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	src := &fakeSource{texts: map[string]string{}}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		src.texts[id] = fmt.Sprintf("<p>texto da parte %s</p>", id)
+	}
+	src.setChapters("a", "b", "c")
+
+	lib, err := library.Open(t.TempDir())
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	_, err = pipeline.Download(context.Background(), src, "https://example.com/story", lib, pipeline.Options{Concurrency: 2, Selection: sources.Selection{Latest: 1}})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	story, ok := lib.Get(library.Key("fake", "42"))
+	require.True(t, ok, "era para a história estar na biblioteca, mas não está")
+	require.Equal(t, []string{"c"}, chapterIDs(story.Chapters))
+
+	// o update continua pegando só a parte mais nova
+	src.setChapters("a", "b", "c", "d")
+	result, err := pipeline.Update(context.Background(), src, lib, story, pipeline.Options{Concurrency: 2})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, []string{"d"}, chapterIDs(result.Changes.Added))
+	require.Equal(t, []string{"c"}, chapterIDs(result.Changes.Removed))
+}
+
+func Test_library_keepsPDFSetup(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	src := &fakeSource{texts: map[string]string{"a": "<p>texto da parte a</p>", "b": "<p>texto da parte b</p>"}}
+	src.setChapters("a")
+
+	lib, err := library.Open(t.TempDir())
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	a5, err := pdf.ParsePageSize("a5")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	config := pdf.Config{PageSize: a5, Margin: 10 * 72 / 25.4}
+	_, err = pipeline.Download(context.Background(), src, "https://example.com/story", lib, pipeline.Options{Concurrency: 2, Format: pipeline.FormatPDF, PDF: config})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	reopened, err := library.Open(lib.Dir())
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	story, ok := reopened.Get(library.Key("fake", "42"))
+	require.True(t, ok, "era para a história estar na biblioteca, mas não está")
+	require.NotNil(t, story.PDF, "a configuração da página não foi guardada")
+	require.Equal(t, config, *story.PDF)
+
+	// o update reescreve o pdf em a5, não no a4 padrão
+	src.setChapters("a", "b")
+	_, err = pipeline.Update(context.Background(), src, reopened, story, pipeline.Options{Concurrency: 2})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	data, err := os.ReadFile(story.OutputPath)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Contains(t, string(data), "/MediaBox [0 0 419.53 595.28]")
+	require.NotContains(t, string(data), "/MediaBox [0 0 595.28")
+}
+
+func chapterIDs(chapters []library.Chapter) []string {
+	ids := []string{}
+	for _, chap := range chapters {
+		ids = append(ids, chap.ID)
+	}
+	return ids
+}
@@ -0,0 +1,141 @@
+package packagetests
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/sources"
+	"wattpad-to-ebook/wattpad_stories"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_lists_readingList(t *testing.T) {
+	fake := newFakeWattpad(t)
+	url := fake.URL + "/list/900000001-club-picks"
+
+	lister, ok := sources.ListerFor(url)
+	require.True(t, ok, "era para a lista ser reconhecida")
+
+	list, err := lister.List(context.Background(), url)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, "list-900000001", list.ID)
+	require.Equal(t, "Club Picks", list.Name)
+	require.Equal(t, "reader_one", list.Author)
+
+	// duas páginas, com a primeira história repetida na segunda
+	require.Equal(t, []string{
+		fake.URL + "/story/389173089-managers-duties",
+		fake.URL + "/story/388706112-sole-elite-disclosed",
+		fake.URL + "/story/300000001-fallback-story",
+	}, list.URLs)
+}
+
+func Test_lists_author(t *testing.T) {
+	fake := newFakeWattpad(t)
+
+	list, err := wattpadstories.Wattpad{}.List(context.Background(), fake.URL+"/user/quietwriter")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, "user-quietwriter", list.ID)
+	require.Equal(t, []string{
+		fake.URL + "/story/389173089-managers-duties",
+		fake.URL + "/story/300000001",
+	}, list.URLs)
+
+	_, isList := sources.ListerFor(fake.URL + "/story/389173089-managers-duties")
+	require.False(t, isList, "a url de uma história não é uma lista")
+}
+
+func Test_lists_batch(t *testing.T) {
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	results := pipeline.Batch(context.Background(), []string{fake.URL + "/list/900000001-club-picks", fake.URL + "/list/1-missing"}, nil, pipeline.Options{Concurrency: 2}, 2)
+	require.Len(t, results, 4)
+
+	for _, result := range results[:3] {
+		require.Nilf(t, result.Err, "Não era pra ter erro, mas tem\nErro: ", result.Err)
+		require.FileExists(t, result.Result.Output)
+	}
+	require.Error(t, results[3].Err, "a lista que não existe tinha que falhar")
+}
+
+func Test_lists_omnibusOfBatchFile(t *testing.T) {
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	// como com -batch arquivo -omnibus: a lista no meio do arquivo vira as histórias dela
+	list := sources.StoryList{ID: "batch-series", Name: "series", URLs: []string{fake.URL + soleElite, fake.URL + "/list/900000001-club-picks"}}
+	result, err := pipeline.Omnibus(context.Background(), list, pipeline.Options{Concurrency: 2})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	epub, err := zip.OpenReader(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	defer epub.Close()
+
+	// a história que também está na lista só entra uma vez
+	stories := 0
+	for _, f := range epub.File {
+		if strings.HasPrefix(f.Name, "OEBPS/story_") {
+			stories++
+		}
+	}
+	require.Equal(t, 3, stories)
+
+	// uma lista que não dá para ler deixa o livro incompleto, então dá erro
+	list.URLs = append(list.URLs, fake.URL+"/list/1-missing")
+	_, err = pipeline.Omnibus(context.Background(), list, pipeline.Options{Concurrency: 2})
+	require.Error(t, err)
+}
+
+func Test_lists_omnibus(t *testing.T) {
+	result := omnibusAs(t, pipeline.FormatEPUB)
+	require.Equal(t, "Club Picks - reader_one.epub", result.Output)
+
+	findings, err := ebook.Validate(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Emptyf(t, findings, "o epub não passou na validação: %v", findings)
+
+	epub, err := zip.OpenReader(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	defer epub.Close()
+
+	// 3 partes + 2 + 2, cada história com a sua página de título, sem nenhum arquivo repetido
+	chapters := 0
+	names := map[string]bool{}
+	for _, f := range epub.File {
+		require.Falsef(t, names[f.Name], "o arquivo '%s' está duas vezes no epub", f.Name)
+		names[f.Name] = true
+		if strings.Contains(f.Name, "_chapter_") {
+			chapters++
+		}
+	}
+	require.Equal(t, 7, chapters)
+	for _, name := range []string{"OEBPS/story_1.xhtml", "OEBPS/story_2.xhtml", "OEBPS/story_3.xhtml", "OEBPS/story1_chapter_1.xhtml", "OEBPS/story2_chapter_1.xhtml", "OEBPS/story3_chapter_2.xhtml", "images/story1_cover.jpg", "images/story2_cover.jpg"} {
+		require.Containsf(t, names, name, "era para o epub ter '%s', mas não tem", name)
+	}
+
+	read := func(name string) string {
+		f, err := epub.Open(name)
+		require.Nilf(t, err, "era para o epub ter '%s', mas não tem", name)
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		return string(data)
+	}
+
+	// as partes ficam dentro da história no sumário
+	nav := read("OEBPS/nav.xhtml")
+	require.Regexp(t, `(?s)<a href="story_2.xhtml">Sole Elite Disclosed</a>\s*<ol>\s*<li>\s*<a href="story2_chapter_1.xhtml">`, nav)
+
+	ncx := read("OEBPS/toc.ncx")
+	require.Contains(t, ncx, `<meta name="dtb:depth" content="2">`)
+	require.Regexp(t, `(?s)<navPoint id="navpoint_1" playOrder="1">.*?<navPoint id="navpoint_2" playOrder="2">`, ncx)
+
+	title := read("OEBPS/story_2.xhtml")
+	require.Contains(t, title, "cote_fan")
+	require.Contains(t, title, "../images/story2_cover.jpg")
+}
@@ -0,0 +1,173 @@
+package packagetests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"wattpad-to-ebook/document"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/pdf"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/sources"
+
+	"github.com/stretchr/testify/require"
+)
+
+// checkXref confirms every offset of the xref table lands on its object,
+// which is what readers use to find them.
+func checkXref(t *testing.T, data []byte) {
+	start := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	require.NotNil(t, start, "o pdf não termina com startxref")
+	offset, _ := strconv.Atoi(string(start[1]))
+	require.True(t, bytes.HasPrefix(data[offset:], []byte("xref\n")), "o startxref não aponta para a tabela xref")
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[offset:], -1)
+	require.NotEmpty(t, entries)
+	for i, entry := range entries {
+		at, _ := strconv.Atoi(string(entry[1]))
+		require.Truef(t, bytes.HasPrefix(data[at:], []byte(strconv.Itoa(i+1)+" 0 obj")), "o objeto %d não está onde a xref diz", i+1)
+	}
+}
+
+func Test_pdf_story(t *testing.T) {
+	_, result := downloadAs(t, pipeline.FormatPDF)
+	require.Equal(t, ".pdf", result.Output[len(result.Output)-4:])
+
+	data, err := os.ReadFile(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.True(t, bytes.HasPrefix(data, []byte("%PDF-1.7\n")), "o arquivo não começa como um pdf")
+	checkXref(t, data)
+
+	// capa, sumário e as duas partes
+	pages := regexp.MustCompile(`/Type /Page /Parent`).FindAll(data, -1)
+	require.Len(t, pages, 4)
+	require.Contains(t, string(data), "/Type /Pages /Kids")
+	require.Contains(t, string(data), "/Count 4 >>")
+
+	// a capa e uma imagem em jpeg, e a png do primeiro capítulo
+	require.Len(t, regexp.MustCompile(`/Filter /DCTDecode`).FindAll(data, -1), 2)
+	require.Len(t, regexp.MustCompile(`/Subtype /Image`).FindAll(data, -1), 3)
+
+	// o sumário tem um link para cada parte, e os marcadores repetem o sumário
+	require.Len(t, regexp.MustCompile(`/Subtype /Link /Rect \[[^\]]+\] /Border \[0 0 0\] /Dest \[\d+ 0 R /Fit\]`).FindAll(data, -1), 2)
+	require.Contains(t, string(data), "/Type /Outlines")
+	require.Contains(t, string(data), "/PageMode /UseOutlines")
+}
+
+func Test_pdf_omnibus(t *testing.T) {
+	result := omnibusAs(t, pipeline.FormatPDF)
+
+	data, err := os.ReadFile(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	checkXref(t, data)
+
+	// capa, sumário, uma página de título para cada história e as 7 partes
+	require.Len(t, regexp.MustCompile(`/Type /Page /Parent`).FindAll(data, -1), 12)
+	require.Len(t, regexp.MustCompile(`/Subtype /Link /Rect`).FindAll(data, -1), 10)
+
+	// os marcadores têm o sumário e as histórias, com as partes dentro delas
+	require.Regexp(t, `/Type /Outlines /First \d+ 0 R /Last \d+ 0 R /Count 11 >>`, string(data))
+	var parts []string
+	for _, story := range regexp.MustCompile(`/Dest \[[^\]]+\][^>]* /First \d+ 0 R /Last \d+ 0 R /Count (\d+) >>`).FindAllSubmatch(data, -1) {
+		parts = append(parts, string(story[1]))
+	}
+	require.Equal(t, []string{"3", "2", "2"}, parts)
+}
+
+func Test_pdf_pageSetup(t *testing.T) {
+	size, err := pdf.ParsePageSize("letter")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, pdf.Size{Width: 612, Height: 792}, size)
+
+	size, err = pdf.ParsePageSize("6x9in")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, pdf.Size{Width: 432, Height: 648}, size)
+
+	size, err = pdf.ParsePageSize("127mmx203.2mm")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.InDelta(t, 360, size.Width, 0.01)
+	require.InDelta(t, 576, size.Height, 0.01)
+
+	for _, bad := range []string{"b7", "6x", "x9in", "0.5x9in"} {
+		_, err := pdf.ParsePageSize(bad)
+		require.Errorf(t, err, "'%s' era para ser inválido", bad)
+	}
+
+	margin, err := pdf.ParseLength("0.5in")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, 36.0, margin)
+
+	_, err = pdf.ParseLength("-3mm")
+	require.Error(t, err, "margem negativa era para ser inválida")
+}
+
+func Test_pdf_marginWithoutPageSize(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Margins", Author: "Nobody"})
+	require.Nil(t, book.AddChapter(1, "One", "<p>text</p>"))
+
+	// só com a margem, a página é A4 e a margem continua a que foi pedida
+	var out bytes.Buffer
+	require.Nil(t, pdf.Write(&out, book, pdf.Config{Margin: 72}))
+	require.Contains(t, out.String(), "/MediaBox [0 0 595.28 841.89]")
+	// o link do sumário começa e termina nas margens
+	require.Regexp(t, `/Subtype /Link /Rect \[72 [\d.]+ 523.28 `, out.String())
+
+	// uma margem larga que ainda deixa espaço para o texto é aceita
+	out.Reset()
+	require.Nil(t, pdf.Write(&out, book, pdf.Config{PageSize: pdf.Size{Width: 595.28, Height: 841.89}, Margin: 60 * 72 / 25.4}))
+}
+
+func Test_pdf_writeFileError(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Margins", Author: "Nobody"})
+	require.Nil(t, book.AddChapter(1, "One", "<p>text</p>"))
+
+	// uma margem que não cabe na página não pode deixar um pdf vazio para trás
+	name := filepath.Join(t.TempDir(), "margins.pdf")
+	err := pdf.WriteFile(name, book, pdf.Config{PageSize: pdf.Size{Width: 200, Height: 200}, Margin: 100})
+	require.Error(t, err)
+	require.NoFileExists(t, name)
+}
+
+func Test_pdf_unsupportedCharacters(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Café", Author: "Nobody"})
+	require.Nil(t, book.AddChapter(1, "Um", "<p>“Olá”, disse ela — são 5€… ñ ç ü</p>"))
+
+	var out bytes.Buffer
+	require.Nil(t, pdf.Write(&out, book, pdf.Config{}), "o português cabe nas fontes padrão")
+
+	// turco não tem como ser desenhado, e o livro não pode sair cheio de "?"
+	book = ebook.NewBook(sources.Story_Metadata{Name: "Yağmur", Author: "Nobody"})
+	require.Nil(t, book.AddChapter(1, "Bir", "<p>Işık ve gölge, ışık ve ş</p>"))
+
+	name := filepath.Join(t.TempDir(), "yagmur.pdf")
+	err := pdf.WriteFile(name, book, pdf.Config{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `'ğ', 'ş', 'ı'`)
+	require.NoFileExists(t, name)
+}
+
+func Test_pdf_document(t *testing.T) {
+	blocks, err := document.Parse(`<p>Plain <b>bold</b>  and
+		<i>italic <a href="https://example.com">link</a></i><br>next</p>
+		<p style="text-align: center">***</p><hr><blockquote><p>quoted</p></blockquote>
+		<p>before<img src="../images/chapter1_img0.png" alt="map">after</p><h2>Part</h2>`)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	require.Equal(t, []document.Block{
+		{Kind: document.Paragraph, Runs: []document.Run{
+			{Text: "Plain "}, {Text: "bold", Bold: true}, {Text: " and "},
+			{Text: "italic ", Italic: true}, {Text: "link", Italic: true, Link: "https://example.com"},
+			{Text: "\nnext"},
+		}},
+		{Kind: document.Paragraph, Align: document.AlignCenter, Runs: []document.Run{{Text: "***"}}},
+		{Kind: document.Rule},
+		{Kind: document.Quote, Runs: []document.Run{{Text: "quoted"}}},
+		{Kind: document.Paragraph, Runs: []document.Run{{Text: "before"}}},
+		{Kind: document.Image, Image: "chapter1_img0.png", Alt: "map"},
+		{Kind: document.Paragraph, Runs: []document.Run{{Text: "after"}}},
+		{Kind: document.Heading, Level: 2, Runs: []document.Run{{Text: "Part"}}},
+	}, blocks)
+}
@@ -0,0 +1,51 @@
+package packagetests
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"wattpad-to-ebook/pool"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_pool_keepsOrder(t *testing.T) {
+	results := make([]int, 50)
+	var running, maxRunning atomic.Int32
+
+	err := pool.Run(context.Background(), 4, len(results), func(ctx context.Context, i int) error {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := maxRunning.Load()
+			if now <= old || maxRunning.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		results[i] = i * i
+		return nil
+	})
+
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.LessOrEqual(t, maxRunning.Load(), int32(4), "rodou mais workers do que o limite")
+	for i, r := range results {
+		require.Equal(t, i*i, r)
+	}
+}
+
+func Test_pool_stopsOnFirstError(t *testing.T) {
+	broken := errors.New("parte quebrada")
+	var started atomic.Int32
+
+	err := pool.Run(context.Background(), 2, 1000, func(ctx context.Context, i int) error {
+		started.Add(1)
+		if i == 3 {
+			return broken
+		}
+		return nil
+	})
+
+	require.ErrorIs(t, err, broken)
+	require.Less(t, started.Load(), int32(1000), "era para parar de começar jobs depois do erro")
+}
@@ -0,0 +1,97 @@
+package packagetests
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/sources"
+	"wattpad-to-ebook/wattpad_stories"
+
+	"github.com/stretchr/testify/require"
+)
+
+func indexes(chapters []sources.Story_Chapters) []int {
+	list := []int{}
+	for _, chap := range chapters {
+		list = append(list, chap.Index)
+	}
+	return list
+}
+
+func Test_selection_apply(t *testing.T) {
+	var chapters []sources.Story_Chapters
+	for i := 1; i <= 10; i++ {
+		chapters = append(chapters, sources.Story_Chapters{Index: i})
+	}
+
+	parts, err := sources.ParseRanges("1, 3,5-7")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, []sources.Range{{From: 1, To: 1}, {From: 3, To: 3}, {From: 5, To: 7}}, parts)
+
+	for _, bad := range []string{"", "0", "a", "5-3", "2-x"} {
+		_, err := sources.ParseRanges(bad)
+		require.Errorf(t, err, "'%s' era para ser inválido", bad)
+	}
+
+	cases := []struct {
+		selection sources.Selection
+		want      []int
+	}{
+		{sources.Selection{}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{sources.Selection{From: 4, To: 6}, []int{4, 5, 6}},
+		{sources.Selection{From: 9}, []int{9, 10}},
+		{sources.Selection{Parts: parts}, []int{1, 3, 5, 6, 7}},
+		{sources.Selection{Parts: parts, From: 4}, []int{5, 6, 7}},
+		{sources.Selection{Latest: 2}, []int{9, 10}},
+		{sources.Selection{Parts: parts, Latest: 1}, []int{7}},
+	}
+	for _, c := range cases {
+		selected, err := c.selection.Apply(chapters)
+		require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+		require.Equalf(t, c.want, indexes(selected), "seleção %+v", c.selection)
+	}
+
+	_, err = sources.Selection{From: 11}.Apply(chapters)
+	require.Error(t, err, "era para dar erro sem nenhuma parte selecionada")
+}
+
+func Test_selection_pipeline(t *testing.T) {
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	parts, err := sources.ParseRanges("1,3")
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	result, err := pipeline.Download(context.Background(), wattpadstories.Wattpad{}, fake.URL+"/story/389173089-manager%27s-duties", nil, pipeline.Options{Concurrency: 2, Selection: sources.Selection{Parts: parts}})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Equal(t, []string{"1512000101", "1512000103"}, fake.fetchedParts(), "a parte 2 não era para ter sido baixada")
+
+	findings, err := ebook.Validate(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Emptyf(t, findings, "o epub não passou na validação: %v", findings)
+
+	epub, err := zip.OpenReader(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	defer epub.Close()
+
+	read := func(name string) string {
+		f, err := epub.Open(name)
+		require.Nilf(t, err, "era para o epub ter '%s', mas não tem", name)
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		return string(data)
+	}
+
+	nav := read("OEBPS/nav.xhtml")
+	require.Contains(t, nav, "1. Monday")
+	require.Contains(t, nav, "3. Friday")
+	require.NotContains(t, nav, "Long Meeting")
+
+	opf := read("OEBPS/content.opf")
+	require.Contains(t, opf, `idref="chapter_3"`)
+	require.False(t, strings.Contains(opf, "chapter_2"), "a parte 2 não era para estar no pacote")
+}
@@ -0,0 +1,155 @@
+package packagetests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/pipeline"
+	"wattpad-to-ebook/sources"
+	"wattpad-to-ebook/textfile"
+	"wattpad-to-ebook/wattpad_stories"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_textfile_markdown(t *testing.T) {
+	_, result := downloadAs(t, pipeline.FormatMarkdown)
+	require.Equal(t, ".md", filepath.Ext(result.Output))
+
+	data, err := os.ReadFile(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	text := string(data)
+
+	require.True(t, strings.HasPrefix(text, "---\ntitle: \"Sole Elite Disclosed\"\n"), "o arquivo tem que começar com o front matter")
+	require.Contains(t, text, "\nsource: \"wattpad\"\nid: \"388706112\"\n")
+	require.Contains(t, text, "\ncover: \"Sole Elite Disclosed - cote_fan_images/cover.jpg\"\n")
+	require.Contains(t, text, "\n# Prologue\n\n")
+	require.Contains(t, text, "\n# Chapter 1: Class D\n\n")
+	require.Contains(t, text, "![](Sole%20Elite%20Disclosed%20-%20cote_fan_images/chapter1_img0.png)")
+
+	// as imagens ficam numa pasta com o nome do arquivo, ao lado dele
+	require.FileExists(t, "Sole Elite Disclosed - cote_fan_images/chapter1_img0.png")
+	require.FileExists(t, "Sole Elite Disclosed - cote_fan_images/cover.jpg")
+	require.NoDirExists(t, "images")
+}
+
+func Test_textfile_omnibus(t *testing.T) {
+	result := omnibusAs(t, pipeline.FormatMarkdown)
+
+	data, err := os.ReadFile(result.Output)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	text := string(data)
+
+	// cada história é um título com o autor e a capa, e as partes ficam um nível abaixo
+	require.Contains(t, text, "\n# Sole Elite Disclosed\n\n*by cote\\_fan*\n\n"+
+		"![Sole Elite Disclosed](Club%20Picks%20-%20reader_one_images/story2_cover.jpg)\n\n## Prologue\n\n")
+	require.Equal(t, 3, strings.Count(text, "\n# "))
+	require.Equal(t, 7, strings.Count(text, "\n## "))
+	require.FileExists(t, "Club Picks - reader_one_images/story2_cover.jpg")
+}
+
+func Test_textfile_twoStoriesInOneDirectory(t *testing.T) {
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	var outputs []string
+	for _, story := range []string{"/story/388706112-sole-elite-disclosed", "/story/389173089-manager%27s-duties"} {
+		result, err := pipeline.Download(context.Background(), wattpadstories.Wattpad{}, fake.URL+story, nil, pipeline.Options{Concurrency: 2, Format: pipeline.FormatText})
+		require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+		outputs = append(outputs, result.Output)
+	}
+
+	// cada história tem a sua capa, uma não sobrescreve a da outra
+	var covers [][]byte
+	for _, output := range outputs {
+		images := strings.TrimSuffix(output, ".txt") + "_images"
+		text, err := os.ReadFile(output)
+		require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+		require.Contains(t, string(text), "Cover: "+images+"/cover.jpg\n")
+
+		cover, err := os.ReadFile(filepath.Join(images, "cover.jpg"))
+		require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+		covers = append(covers, cover)
+	}
+	require.NotEqual(t, covers[0], covers[1], "as duas histórias ficaram com a mesma capa")
+}
+
+func Test_textfile_splitText(t *testing.T) {
+	fake := newFakeWattpad(t)
+	t.Chdir(t.TempDir())
+
+	url := fake.URL + "/story/388706112-sole-elite-disclosed"
+	result, err := pipeline.Download(context.Background(), wattpadstories.Wattpad{}, url, nil, pipeline.Options{Concurrency: 2, Format: pipeline.FormatText, Split: true})
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.DirExists(t, result.Output)
+
+	for _, name := range []string{"index.txt", "chapter_1.txt", "chapter_2.txt", "images/chapter1_img0.png"} {
+		require.FileExists(t, filepath.Join(result.Output, name))
+	}
+
+	index, err := os.ReadFile(filepath.Join(result.Output, "index.txt"))
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.Contains(t, string(index), "Title: Sole Elite Disclosed\n")
+	require.Contains(t, string(index), "Prologue (chapter_1.txt)\n")
+
+	chapter, err := os.ReadFile(filepath.Join(result.Output, "chapter_1.txt"))
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	require.True(t, strings.HasPrefix(string(chapter), "Prologue\n========\n\n"), "o capítulo tem que começar pelo título")
+	require.Contains(t, string(chapter), "[image: images/chapter1_img0.png]")
+}
+
+func Test_textfile_markup(t *testing.T) {
+	book := ebook.NewBook(sources.Story_Metadata{Name: "Marks", Author: "Nobody", Tags: []string{"a", "b c"}, Description: "Two\nlines"})
+	long := strings.Repeat("word ", 40)
+	err := book.AddChapter(1, "One", `<p>Plain <b>bold </b>and <i>it</i> <a href="https://example.com/a b">link</a></p>
+		<p># not a heading, 2*3_4</p><p>1. not a list</p><p>first<br>second</p>
+		<blockquote><p>quoted</p></blockquote><hr><h2>Inner</h2><pre>a  b</pre><p>`+long+`</p>`)
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+
+	var md strings.Builder
+	require.Nil(t, textfile.Write(&md, book, textfile.Markdown))
+	require.Equal(t, `---
+title: "Marks"
+author: "Nobody"
+status: "ongoing"
+tags: ["a", "b c"]
+description: |
+  Two
+  lines
+---
+
+# One
+
+Plain **bold** and *it* [link](https://example.com/a%20b)
+
+\# not a heading, 2\*3\_4
+
+1\. not a list
+
+first\
+second
+
+> quoted
+
+* * *
+
+### Inner
+
+`+"```\na  b\n```"+`
+
+`+strings.TrimSpace(long)+`
+`, md.String())
+
+	var txt strings.Builder
+	require.Nil(t, textfile.Write(&txt, book, textfile.Text))
+	require.Contains(t, txt.String(), "Title: Marks\nAuthor: Nobody\nStatus: ongoing\nTags: a, b c\n")
+	require.Contains(t, txt.String(), "\nOne\n===\n\nPlain bold and it link <https://example.com/a b>\n")
+	require.Contains(t, txt.String(), "\n    quoted\n")
+	for _, line := range strings.Split(txt.String(), "\n") {
+		require.LessOrEqualf(t, utf8.RuneCountInString(line), 72, "a linha '%s' passou de 72 caracteres", line)
+	}
+}
@@ -0,0 +1,85 @@
+package packagetests
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+	"wattpad-to-ebook/ebook"
+
+	"github.com/stretchr/testify/require"
+)
+
+// brokenEpub has one of each problem the validator knows about.
+func brokenEpub(t *testing.T) *zip.Reader {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	add := func(name string, content string) {
+		f, err := w.Create(name)
+		require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+		f.Write([]byte(content))
+	}
+
+	// mimetype comprimido e fora do lugar
+	add("META-INF/container.xml", `<?xml version="1.0"?>
+<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container" version="1.0">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`)
+	add("mimetype", "application/epub+zip")
+	add("OEBPS/content.opf", `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="chapter_1" href="chapter_1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="chapter_1" href="chapter_2.xhtml" media-type="application/xhtml+xml"/>
+    <item id="img" href="../images/a.jpg" media-type="image/jpeg"/>
+  </manifest>
+  <spine><itemref idref="chapter_1"/><itemref idref="chapter_9"/></spine>
+  <guide><reference type="text" title="Start" href="chapter_4.xhtml"/></guide>
+</package>`)
+	add("OEBPS/nav.xhtml", `<?xml version="1.0"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><body>
+<nav epub:type="toc"><ol><li><a href="chapter_1.xhtml">1</a></li><li><a href="chapter_3.xhtml#top">3</a></li></ol></nav>
+</body></html>`)
+	add("OEBPS/chapter_1.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>unclosed</body></html>`)
+	add("images/a.jpg", "\x89PNG\r\n\x1a\n not really a jpeg")
+	add("OEBPS/stray.css", "p {}")
+
+	require.Nil(t, w.Close())
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.Nilf(t, err, "Não era pra ter erro, mas tem\nErro: ", err)
+	return r
+}
+
+func Test_validate_findsProblems(t *testing.T) {
+	findings := ebook.ValidateZip(brokenEpub(t))
+
+	codes := map[string]int{}
+	for _, f := range findings {
+		codes[f.Code]++
+		t.Log(f.Format("broken.epub"))
+	}
+
+	require.Contains(t, codes, "PKG-006", "mimetype fora do lugar")
+	require.Contains(t, codes, "PKG-007", "mimetype comprimido")
+	require.Contains(t, codes, "RSC-001", "chapter_2.xhtml não existe")
+	require.Contains(t, codes, "RSC-005", "id repetido no manifest")
+	require.Contains(t, codes, "OPF-049", "itemref para chapter_9")
+	require.Contains(t, codes, "RSC-016", "chapter_1.xhtml mal formado")
+	require.Contains(t, codes, "RSC-007", "o nav aponta para chapter_3.xhtml")
+	require.Contains(t, codes, "OPF-029", "png declarado como jpeg")
+	require.Contains(t, codes, "OPF-003", "stray.css fora do manifest")
+
+	guide := false
+	for _, f := range findings {
+		guide = guide || (f.Code == "RSC-007" && f.Path == "OEBPS/content.opf" && strings.Contains(f.Message, "chapter_4.xhtml"))
+	}
+	require.True(t, guide, "o guide aponta para chapter_4.xhtml")
+}
+
+func Test_validate_format(t *testing.T) {
+	f := ebook.Finding{Severity: ebook.SeverityError, Code: "RSC-001", Path: "OEBPS/content.opf", Message: `File "x" could not be found`}
+	require.Equal(t, `ERROR(RSC-001): book.epub/OEBPS/content.opf: File "x" could not be found`, f.Format("book.epub"))
+}
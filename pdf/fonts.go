@@ -0,0 +1,121 @@
+package pdf
+
+// The book uses the standard Helvetica fonts every PDF reader has, so no font
+// file needs to be embedded. Their glyphs only cover WinAnsiEncoding
+// (Windows-1252), so a book with text outside it, like Greek, Cyrillic,
+// Turkish or CJK, is refused instead of being drawn as "?".
+
+type font int
+
+const (
+	regular font = iota
+	bold
+	italic
+	boldItalic
+)
+
+// fontNames are the BaseFont of each font, in the order of the constants.
+var fontNames = [...]string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique"}
+
+func styleFont(isBold bool, isItalic bool) font {
+	switch {
+	case isBold && isItalic:
+		return boldItalic
+	case isBold:
+		return bold
+	case isItalic:
+		return italic
+	}
+	return regular
+}
+
+// resource is the name the font has in the page resources.
+func (f font) resource() string {
+	return [...]string{"F1", "F2", "F3", "F4"}[f]
+}
+
+// width returns how wide s, already encoded, is at size points.
+func (f font) width(s []byte, size float64) float64 {
+	table := &helveticaWidths
+	if f == bold || f == boldItalic {
+		table = &helveticaBoldWidths
+	}
+
+	total := 0
+	for _, c := range s {
+		if c < 32 {
+			continue
+		}
+		total += int(table[c-32])
+	}
+	return float64(total) * size / 1000
+}
+
+// winAnsi are the characters of Windows-1252 between 0x80 and 0x9f, the only
+// ones that aren't the same as in Unicode.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e,
+	'\u2018': 0x91, '\u2019': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// encode converts s to WinAnsiEncoding, leaving out and returning the
+// characters that aren't in it.
+func encode(s string) ([]byte, []rune) {
+	out := make([]byte, 0, len(s))
+	var missing []rune
+	for _, r := range s {
+		switch {
+		case r == '\u00a0':
+			out = append(out, ' ')
+		case r >= 32 && r < 127, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		case winAnsi[r] != 0:
+			out = append(out, winAnsi[r])
+		case r == '\u200b' || r == '\ufeff' || r == '\u00ad':
+			// invisible, nothing to draw
+		default:
+			missing = append(missing, r)
+		}
+	}
+	return out, missing
+}
+
+// Widths of the characters 32 to 255, in thousandths of the font size, from
+// the Adobe metrics of Helvetica. The oblique fonts have the same widths.
+var helveticaWidths = [224]uint16{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278,
+	278, 556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584,
+	584, 556, 1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556,
+	833, 722, 778, 667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278,
+	278, 278, 469, 556, 333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222,
+	500, 222, 833, 556, 556, 556, 556, 333, 500, 278, 556, 500, 722, 500, 500,
+	500, 334, 260, 334, 584, 350, 556, 350, 222, 556, 333, 1000, 556, 556, 333,
+	1000, 667, 333, 1000, 350, 611, 350, 350, 222, 222, 333, 333, 350, 556,
+	1000, 333, 1000, 500, 333, 944, 350, 500, 667, 278, 333, 556, 556, 556, 556,
+	260, 556, 333, 737, 370, 556, 584, 333, 737, 333, 400, 584, 333, 333, 333,
+	556, 537, 278, 333, 333, 365, 556, 834, 834, 834, 611, 667, 667, 667, 667,
+	667, 667, 1000, 722, 667, 667, 667, 667, 278, 278, 278, 278, 722, 722, 778,
+	778, 778, 778, 778, 584, 778, 722, 722, 722, 722, 667, 667, 611, 556, 556,
+	556, 556, 556, 556, 889, 500, 556, 556, 556, 556, 278, 278, 278, 278, 556,
+	556, 556, 556, 556, 556, 556, 584, 611, 556, 556, 556, 556, 500, 556, 500,
+}
+
+var helveticaBoldWidths = [224]uint16{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278,
+	278, 556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584,
+	584, 611, 975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611,
+	833, 722, 778, 667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333,
+	278, 333, 584, 556, 333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278,
+	556, 278, 889, 611, 611, 611, 611, 389, 556, 333, 611, 556, 778, 556, 556,
+	500, 389, 280, 389, 584, 350, 556, 350, 278, 556, 500, 1000, 556, 556, 333,
+	1000, 667, 333, 1000, 350, 611, 350, 350, 278, 278, 500, 500, 350, 556,
+	1000, 333, 1000, 556, 333, 944, 350, 500, 667, 278, 333, 556, 556, 556, 556,
+	280, 556, 333, 737, 370, 556, 584, 333, 737, 333, 400, 584, 333, 333, 333,
+	611, 556, 278, 333, 333, 365, 556, 834, 834, 834, 611, 722, 722, 722, 722,
+	722, 722, 1000, 722, 667, 667, 667, 667, 278, 278, 278, 278, 722, 722, 778,
+	778, 778, 778, 778, 584, 778, 722, 722, 722, 722, 667, 667, 611, 556, 556,
+	556, 556, 556, 556, 889, 556, 556, 556, 556, 556, 278, 278, 278, 278, 611,
+	611, 611, 611, 611, 611, 611, 584, 611, 611, 611, 611, 611, 556, 611, 556,
+}
@@ -0,0 +1,73 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// pdfImage is an image XObject. JPEGs go into the PDF as they are, any
+// other format the standard library reads is decoded and stored as RGB.
+type pdfImage struct {
+	resource string
+	width    int
+	height   int
+	// dict is the stream dictionary, without /Length and /Filter for the
+	// images that get compressed.
+	dict     string
+	data     []byte
+	compress bool
+	id       int
+}
+
+func loadImage(data []byte, resource string) (*pdfImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return nil, fmt.Errorf("imagem vazia")
+	}
+
+	img := &pdfImage{resource: resource, width: config.Width, height: config.Height}
+	base := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /BitsPerComponent 8", config.Width, config.Height)
+
+	if format == "jpeg" {
+		colorSpace := "/DeviceRGB"
+		switch config.ColorModel {
+		case color.GrayModel:
+			colorSpace = "/DeviceGray"
+		case color.CMYKModel:
+			// Adobe writes CMYK JPEGs inverted, and so does almost everyone after it
+			colorSpace = "/DeviceCMYK /Decode [1 0 1 0 1 0 1 0]"
+		}
+		img.dict = base + " /ColorSpace " + colorSpace + " /Filter /DCTDecode"
+		img.data = data
+		return img, nil
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// transparent parts are painted over white, the colour of the page
+	bounds := decoded.Bounds()
+	rgb := make([]byte, 0, 3*bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := decoded.At(x, y).RGBA()
+			white := 0xffff - a
+			rgb = append(rgb, byte((r+white)>>8), byte((g+white)>>8), byte((b+white)>>8))
+		}
+	}
+
+	img.dict = base + " /ColorSpace /DeviceRGB"
+	img.data = rgb
+	img.compress = true
+	return img, nil
+}
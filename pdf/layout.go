@@ -0,0 +1,553 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"wattpad-to-ebook/document"
+	"wattpad-to-ebook/ebook"
+)
+
+const (
+	bodySize    = 11.0
+	titleSize   = 20.0
+	leading     = 1.4
+	quoteIndent = 24.0
+	footerSize  = 9.0
+)
+
+// page is a laid out page: its content stream and the links on it.
+type page struct {
+	content bytes.Buffer
+	links   []link
+	// numbered pages get their number in the footer
+	numbered bool
+}
+
+// link is a clickable area of a page, given in PDF coordinates. It opens
+// uri, or goes to the page of dest or of the chapter href.
+type link struct {
+	rect [4]float64
+	uri  string
+	dest *page
+	href string
+}
+
+// pdfDoc is a book laid out on pages, ready to be written.
+type pdfDoc struct {
+	cfg    Config
+	images map[string]ebook.Image
+	// loaded are the images already turned into XObjects, nil for the ones
+	// that couldn't be read, by name.
+	loaded map[string]*pdfImage
+	order  []*pdfImage
+
+	pages []*page
+	page  *page
+	// y is how far the cursor is from the top of the page
+	y float64
+	// starts is the first page of every chapter and section, by Href.
+	starts map[string]*page
+	// body are the pages of the chapters and sections
+	body []*page
+	toc  []*page
+	// missing are the characters of the book the fonts don't have, in the
+	// order they were found.
+	missing []rune
+	// labels are the words of the pages the book doesn't have, like the
+	// table of contents, in its language.
+	labels ebook.Labels
+}
+
+func layOut(book *ebook.Book, cfg Config) (*pdfDoc, error) {
+	doc := &pdfDoc{cfg: cfg, images: map[string]ebook.Image{}, loaded: map[string]*pdfImage{}, starts: map[string]*page{}, labels: book.Labels()}
+	for _, img := range book.Images() {
+		doc.images[img.Name] = img
+	}
+
+	doc.coverPage(book)
+
+	// the chapters go first so the table of contents knows their pages, and
+	// it is put in front of them afterwards
+	cover := doc.pages
+	doc.pages = nil
+	for _, entry := range book.TOC() {
+		if err := doc.entry(entry); err != nil {
+			return nil, err
+		}
+	}
+	doc.body = doc.pages
+
+	doc.pages = nil
+	count := len(doc.contents(book.TOC(), 0))
+	doc.pages = nil
+	doc.toc = doc.contents(book.TOC(), len(cover)+count)
+
+	if len(doc.missing) > 0 {
+		return nil, unsupported(doc.missing)
+	}
+
+	doc.pages = append(append(cover, doc.toc...), doc.body...)
+	return doc, nil
+}
+
+// unsupported is the error for a book with characters the fonts don't have.
+func unsupported(missing []rune) error {
+	var quoted []string
+	for _, r := range missing[:min(len(missing), 10)] {
+		quoted = append(quoted, strconv.QuoteRune(r))
+	}
+	if len(missing) > 10 {
+		quoted = append(quoted, "...")
+	}
+	return fmt.Errorf("as fontes do pdf só têm os caracteres das línguas da Europa Ocidental, e o livro usa %s; escolha outro formato, como epub, html ou docx", strings.Join(quoted, ", "))
+}
+
+// encode converts s for the fonts, taking note of the characters they don't
+// have.
+func (d *pdfDoc) encode(s string) []byte {
+	out, missing := encode(s)
+	for _, r := range missing {
+		if !slices.Contains(d.missing, r) {
+			d.missing = append(d.missing, r)
+		}
+	}
+	return out
+}
+
+func (d *pdfDoc) width() float64 {
+	return d.cfg.PageSize.Width - 2*d.cfg.Margin
+}
+
+// bottom is the lowest y the text can reach.
+func (d *pdfDoc) bottom() float64 {
+	return d.cfg.PageSize.Height - d.cfg.Margin
+}
+
+func (d *pdfDoc) newPage(numbered bool) {
+	d.page = &page{numbered: numbered}
+	d.pages = append(d.pages, d.page)
+	d.y = d.cfg.Margin
+}
+
+// room starts a new page when height doesn't fit under the cursor.
+func (d *pdfDoc) room(height float64) {
+	if d.page == nil || d.y+height > d.bottom() {
+		d.newPage(true)
+	}
+}
+
+// image returns the XObject of the image called name, nil when the book has
+// no such image or it can't be read, in which case it is left out.
+func (d *pdfDoc) image(name string, data []byte) *pdfImage {
+	if img, ok := d.loaded[name]; ok {
+		return img
+	}
+	if data == nil {
+		data = d.images[name].Data
+	}
+
+	img, err := loadImage(data, fmt.Sprintf("Im%d", len(d.order)+1))
+	if err != nil {
+		img = nil
+	} else {
+		d.order = append(d.order, img)
+	}
+	d.loaded[name] = img
+	return img
+}
+
+// drawImage paints img with its lower left corner at x, y in PDF coordinates.
+func (d *pdfDoc) drawImage(img *pdfImage, x float64, y float64, w float64, h float64) {
+	fmt.Fprintf(&d.page.content, "q %s 0 0 %s %s %s cm /%s Do Q\n", num(w), num(h), num(x), num(y), img.resource)
+}
+
+// fit scales a w by h box down until it fits in maxW by maxH.
+func fit(w float64, h float64, maxW float64, maxH float64) (float64, float64) {
+	scale := 1.0
+	if w > maxW {
+		scale = maxW / w
+	}
+	if h*scale > maxH {
+		scale = maxH / h
+	}
+	return w * scale, h * scale
+}
+
+// coverPage is the cover of the book filling the page, or a page with the
+// title and author when there is no cover.
+func (d *pdfDoc) coverPage(book *ebook.Book) {
+	d.newPage(false)
+	size := d.cfg.PageSize
+
+	if data, _ := book.Cover(); data != nil {
+		if img := d.image("cover", data); img != nil {
+			// small covers are blown up too, keeping their shape
+			scale := min(size.Width/float64(img.width), size.Height/float64(img.height))
+			w, h := float64(img.width)*scale, float64(img.height)*scale
+			d.drawImage(img, (size.Width-w)/2, (size.Height-h)/2, w, h)
+			return
+		}
+	}
+
+	d.y = size.Height / 3
+	d.paragraph([]document.Run{{Text: book.Metadata.Name, Bold: true}}, 26, d.cfg.Margin, d.width(), true)
+	d.y += 12
+	d.paragraph([]document.Run{{Text: book.Metadata.Author}}, 14, d.cfg.Margin, d.width(), true)
+}
+
+// entry lays out a chapter, or a section with its title page and chapters.
+func (d *pdfDoc) entry(entry ebook.Entry) error {
+	if entry.Section != nil {
+		d.sectionPage(entry.Section)
+		for _, child := range entry.Children {
+			if err := d.entry(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return d.chapter(entry.Chapter)
+}
+
+func (d *pdfDoc) sectionPage(section *ebook.Section) {
+	d.newPage(true)
+	d.starts[section.Href] = d.page
+
+	d.y = d.cfg.PageSize.Height / 4
+	if section.Cover != "" {
+		if img := d.image(section.Cover, nil); img != nil {
+			w, h := fit(float64(img.width)*0.75, float64(img.height)*0.75, d.width(), d.cfg.PageSize.Height/2-d.cfg.Margin)
+			d.y = d.cfg.Margin
+			d.drawImage(img, (d.cfg.PageSize.Width-w)/2, d.cfg.PageSize.Height-d.y-h, w, h)
+			d.y += h + 24
+		}
+	}
+
+	d.paragraph([]document.Run{{Text: section.Title, Bold: true}}, 24, d.cfg.Margin, d.width(), true)
+	if section.Author != "" {
+		d.y += 8
+		d.paragraph([]document.Run{{Text: section.Author}}, 14, d.cfg.Margin, d.width(), true)
+	}
+}
+
+func (d *pdfDoc) chapter(chapter *ebook.Chapter) error {
+	blocks, err := document.Parse(chapter.Body)
+	if err != nil {
+		return fmt.Errorf("capítulo '%s': %w", chapter.Title, err)
+	}
+
+	d.newPage(true)
+	d.starts[chapter.Href] = d.page
+	d.paragraph([]document.Run{{Text: chapter.Title, Bold: true}}, titleSize, d.cfg.Margin, d.width(), false)
+	d.y += titleSize * 0.8
+
+	for _, block := range blocks {
+		d.block(block)
+	}
+	return nil
+}
+
+func (d *pdfDoc) block(block document.Block) {
+	left, width := d.cfg.Margin, d.width()
+
+	switch block.Kind {
+	case document.Image:
+		d.imageBlock(block)
+		return
+
+	case document.Rule:
+		d.y += bodySize * 0.5
+		d.paragraph([]document.Run{{Text: "*   *   *"}}, bodySize, left, width, true)
+		d.y += bodySize * 0.5
+		return
+
+	case document.Heading:
+		size := map[int]float64{1: 18, 2: 16, 3: 14}[block.Level]
+		if size == 0 {
+			size = 12
+		}
+		runs := make([]document.Run, len(block.Runs))
+		for i, run := range block.Runs {
+			run.Bold = true
+			runs[i] = run
+		}
+		d.y += size * 0.4
+		d.paragraph(runs, size, left, width, block.Align == document.AlignCenter)
+		d.y += size * 0.4
+		return
+
+	case document.Quote:
+		left += quoteIndent
+		width -= 2 * quoteIndent
+
+	case document.Preformatted:
+		// spaces in <pre> are kept and don't break the line
+		runs := make([]document.Run, len(block.Runs))
+		for i, run := range block.Runs {
+			run.Text = strings.ReplaceAll(run.Text, " ", "\u00a0")
+			runs[i] = run
+		}
+		block.Runs = runs
+	}
+
+	d.paragraph(block.Runs, bodySize, left, width, block.Align == document.AlignCenter)
+	d.y += bodySize * 0.6
+}
+
+// imageBlock draws an image of the chapter centred, at its own size if it
+// fits the page, otherwise as big as it can.
+func (d *pdfDoc) imageBlock(block document.Block) {
+	img := d.image(block.Image, nil)
+	if img == nil {
+		return
+	}
+
+	// pixels are taken to be 1/96 of an inch, as in CSS
+	w, h := fit(float64(img.width)*0.75, float64(img.height)*0.75, d.width(), d.bottom()-d.cfg.Margin)
+	d.room(h)
+	d.drawImage(img, (d.cfg.PageSize.Width-w)/2, d.cfg.PageSize.Height-d.y-h, w, h)
+	d.y += h + bodySize*0.6
+}
+
+// fragment is a piece of a word in a single font.
+type fragment struct {
+	font font
+	text []byte
+	link string
+}
+
+// word is text between two spaces, which may change style in the middle.
+type word struct {
+	fragments []fragment
+	width     float64
+}
+
+// words splits runs into lines at the line breaks, and those into words.
+func (d *pdfDoc) words(runs []document.Run, size float64) [][]word {
+	lines := [][]word{nil}
+	var current word
+	var text strings.Builder
+	var style document.Run
+
+	endFragment := func() {
+		if text.Len() == 0 {
+			return
+		}
+		f := fragment{font: styleFont(style.Bold, style.Italic), text: d.encode(text.String()), link: style.Link}
+		text.Reset()
+		if len(f.text) == 0 {
+			return
+		}
+		current.fragments = append(current.fragments, f)
+		current.width += f.font.width(f.text, size)
+	}
+	endWord := func() {
+		endFragment()
+		if len(current.fragments) > 0 {
+			lines[len(lines)-1] = append(lines[len(lines)-1], current)
+		}
+		current = word{}
+	}
+
+	for _, run := range runs {
+		endFragment()
+		style = run
+		for _, r := range run.Text {
+			switch r {
+			case ' ':
+				endWord()
+			case '\n':
+				endWord()
+				lines = append(lines, nil)
+			default:
+				text.WriteRune(r)
+			}
+		}
+	}
+	endWord()
+	return lines
+}
+
+// split breaks a word wider than width into pieces that fit.
+func split(w word, width float64, size float64) []word {
+	var pieces []word
+	var current word
+
+	for _, f := range w.fragments {
+		start := 0
+		for i := range f.text {
+			piece := f.font.width(f.text[start:i+1], size)
+			if current.width+piece > width && (i > start || len(current.fragments) > 0) {
+				if i > start {
+					current.fragments = append(current.fragments, fragment{font: f.font, text: f.text[start:i], link: f.link})
+					current.width += f.font.width(f.text[start:i], size)
+				}
+				pieces = append(pieces, current)
+				current = word{}
+				start = i
+			}
+		}
+		rest := f.text[start:]
+		current.fragments = append(current.fragments, fragment{font: f.font, text: rest, link: f.link})
+		current.width += f.font.width(rest, size)
+	}
+	return append(pieces, current)
+}
+
+// paragraph wraps runs to width and draws them from the cursor down,
+// starting new pages as needed.
+func (d *pdfDoc) paragraph(runs []document.Run, size float64, left float64, width float64, center bool) {
+	space := regular.width([]byte{' '}, size)
+	lineHeight := size * leading
+
+	for _, hard := range d.words(runs, size) {
+		var line []word
+		lineWidth := 0.0
+
+		flush := func() {
+			d.room(lineHeight)
+			x := left
+			if center {
+				x += (width - lineWidth) / 2
+			}
+			d.line(line, x, d.y+size, size, space)
+			d.y += lineHeight
+			line, lineWidth = nil, 0
+		}
+
+		var pending []word
+		for _, w := range hard {
+			if w.width > width {
+				pending = append(pending, split(w, width, size)...)
+			} else {
+				pending = append(pending, w)
+			}
+		}
+
+		for _, w := range pending {
+			if len(line) > 0 && lineWidth+space+w.width > width {
+				flush()
+			}
+			if len(line) > 0 {
+				lineWidth += space
+			}
+			line = append(line, w)
+			lineWidth += w.width
+		}
+		// an empty line is a <br> on its own, and still takes its height
+		flush()
+	}
+}
+
+// line draws a line of words with baseline at y, measured from the top, as
+// a single text object that only switches fonts where the style changes.
+func (d *pdfDoc) line(line []word, x float64, y float64, size float64, space float64) {
+	if len(line) == 0 {
+		return
+	}
+	baseline := d.cfg.PageSize.Height - y
+	content := &d.page.content
+
+	fmt.Fprintf(content, "BT %s %s Td", num(x), num(baseline))
+	current := font(-1)
+	show := func(f font, text []byte) {
+		if f != current {
+			fmt.Fprintf(content, " /%s %s Tf", f.resource(), num(size))
+			current = f
+		}
+		fmt.Fprintf(content, " %s Tj", literal(text))
+	}
+
+	for i, w := range line {
+		if i > 0 {
+			// spaces are measured in the regular font whatever the style around them
+			show(regular, []byte{' '})
+			x += space
+		}
+		for _, f := range w.fragments {
+			show(f.font, f.text)
+			fw := f.font.width(f.text, size)
+			if f.link != "" {
+				d.addLink(f.link, [4]float64{x, baseline - size*0.25, x + fw, baseline + size*0.8})
+			}
+			x += fw
+		}
+	}
+	content.WriteString(" ET\n")
+}
+
+func (d *pdfDoc) addLink(href string, rect [4]float64) {
+	lower := strings.ToLower(href)
+	switch {
+	case strings.HasPrefix(lower, "http://"), strings.HasPrefix(lower, "https://"), strings.HasPrefix(lower, "mailto:"):
+		d.page.links = append(d.page.links, link{rect: rect, uri: href})
+	case strings.HasPrefix(href, "#"), strings.Contains(href, ":"):
+		// anchors inside a chapter and other schemes have nowhere to go
+	default:
+		// a link to another chapter of the book, resolved once every chapter has a page
+		href, _, _ = strings.Cut(href, "#")
+		d.page.links = append(d.page.links, link{rect: rect, href: href[strings.LastIndex(href, "/")+1:]})
+	}
+}
+
+// contents lays out the table of contents, taking the pages before the
+// chapters to be offset, and returns its pages.
+func (d *pdfDoc) contents(entries []ebook.Entry, offset int) []*page {
+	d.newPage(true)
+	d.paragraph([]document.Run{{Text: d.labels.Contents, Bold: true}}, titleSize, d.cfg.Margin, d.width(), false)
+	d.y += titleSize * 0.8
+
+	var walk func(entries []ebook.Entry, depth int)
+	walk = func(entries []ebook.Entry, depth int) {
+		for _, entry := range entries {
+			d.contentsLine(entry, depth, offset)
+			walk(entry.Children, depth+1)
+		}
+	}
+	walk(entries, 0)
+	return d.pages
+}
+
+// contentsLine is a line of the table of contents, with the page number on
+// the right and a link to the chapter over the whole line.
+func (d *pdfDoc) contentsLine(entry ebook.Entry, depth int, offset int) {
+	lineHeight := bodySize * leading
+	d.room(lineHeight)
+
+	f := regular
+	if entry.Section != nil {
+		f = bold
+	}
+
+	target := d.starts[entry.Href]
+	var number []byte
+	for i, p := range d.body {
+		if p == target {
+			number = d.encode(fmt.Sprint(offset + i + 1))
+		}
+	}
+
+	left := d.cfg.Margin + float64(depth)*14
+	right := d.cfg.PageSize.Width - d.cfg.Margin
+	numberWidth := regular.width(number, bodySize)
+	room := right - left - numberWidth - bodySize
+
+	title := d.encode(entry.Title)
+	if f.width(title, bodySize) > room {
+		ellipsis := d.encode("…")
+		for len(title) > 0 && f.width(append(title[:len(title):len(title)], ellipsis...), bodySize) > room {
+			title = title[:len(title)-1]
+		}
+		title = append(title[:len(title):len(title)], ellipsis...)
+	}
+
+	baseline := d.cfg.PageSize.Height - d.y - bodySize
+	fmt.Fprintf(&d.page.content, "BT /%s %s Tf %s %s Td %s Tj ET\n", f.resource(), num(bodySize), num(left), num(baseline), literal(title))
+	fmt.Fprintf(&d.page.content, "BT /%s %s Tf %s %s Td %s Tj ET\n", regular.resource(), num(bodySize), num(right-numberWidth), num(baseline), literal(number))
+	d.page.links = append(d.page.links, link{rect: [4]float64{left, baseline - bodySize*0.25, right, baseline + bodySize*0.8}, dest: target})
+
+	d.y += lineHeight
+}
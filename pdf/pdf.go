@@ -0,0 +1,126 @@
+// Package pdf lays a book out on pages and writes it as a PDF, with the
+// cover, a table of contents with links to the chapters, bookmarks and the
+// images of the chapters. It only uses the standard library and the fonts
+// every PDF reader has built in.
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"wattpad-to-ebook/ebook"
+)
+
+// Size is the size of a page in points, 72 to the inch.
+type Size struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+var pageSizes = map[string]Size{
+	"a4":     {595.28, 841.89},
+	"a5":     {419.53, 595.28},
+	"a6":     {297.64, 419.53},
+	"letter": {612, 792},
+	"legal":  {612, 1008},
+}
+
+// Config is the page setup of the PDF.
+type Config struct {
+	PageSize Size `json:"page_size"`
+	// Margin is the space left blank on every side of the page, in points.
+	Margin float64 `json:"margin"`
+}
+
+// DefaultConfig is an A4 page with 18mm margins.
+func DefaultConfig() Config {
+	return Config{PageSize: pageSizes["a4"], Margin: 18 * 72 / 25.4}
+}
+
+// ParsePageSize reads a page size by name (a4, a5, a6, letter, legal) or as
+// "<width>x<height>" with a unit, like 6x9in or 150x220mm.
+func ParsePageSize(s string) (Size, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if size, ok := pageSizes[s]; ok {
+		return size, nil
+	}
+
+	width, height, found := strings.Cut(s, "x")
+	if !found {
+		return Size{}, fmt.Errorf("tamanho de página desconhecido '%s'", s)
+	}
+	// the unit may be written once at the end, as in 6x9in
+	unit := strings.TrimLeft(height, "0123456789.")
+	if strings.TrimLeft(width, "0123456789.") == "" {
+		width += unit
+	}
+
+	w, err := ParseLength(width)
+	if err != nil {
+		return Size{}, err
+	}
+	h, err := ParseLength(height)
+	if err != nil {
+		return Size{}, err
+	}
+	if w < 72 || h < 72 {
+		return Size{}, fmt.Errorf("a página '%s' é pequena demais", s)
+	}
+	return Size{Width: w, Height: h}, nil
+}
+
+// ParseLength reads a length in mm, cm, in or pt (the default) into points.
+func ParseLength(length string) (float64, error) {
+	s := strings.ToLower(strings.TrimSpace(length))
+
+	units := []struct {
+		suffix string
+		points float64
+	}{{"mm", 72 / 25.4}, {"cm", 72 / 2.54}, {"in", 72}, {"pt", 1}}
+	scale := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSuffix(s, unit.suffix)
+			scale = unit.points
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("medida inválida '%s'", length)
+	}
+	return value * scale, nil
+}
+
+// Write lays book out with cfg and writes the PDF to w. The zero Config
+// means DefaultConfig, and a Config with a margin but no page size gets the
+// page of DefaultConfig and keeps its margin. Margins that leave no room
+// between them are an error. The chapter bodies must already point at the
+// images of the book, like they do in the EPUB.
+func Write(w io.Writer, book *ebook.Book, cfg Config) error {
+	if cfg == (Config{}) {
+		cfg = DefaultConfig()
+	}
+	if cfg.PageSize == (Size{}) {
+		cfg.PageSize = DefaultConfig().PageSize
+	}
+	if 2*cfg.Margin >= cfg.PageSize.Width || 2*cfg.Margin >= cfg.PageSize.Height {
+		return fmt.Errorf("margem de %.0fpt grande demais para a página", cfg.Margin)
+	}
+
+	doc, err := layOut(book, cfg)
+	if err != nil {
+		return err
+	}
+	return doc.write(w, book)
+}
+
+// WriteFile writes the PDF of book to the file name. A half-written file is
+// removed on error.
+func WriteFile(name string, book *ebook.Book, cfg Config) error {
+	return ebook.CreateFile(name, func(w io.Writer) error {
+		return Write(w, book, cfg)
+	})
+}
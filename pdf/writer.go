@@ -0,0 +1,254 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"wattpad-to-ebook/ebook"
+)
+
+// writer writes numbered objects and keeps their offsets for the xref table.
+// Numbers are handed out with alloc before the object is written, so objects
+// can point at each other in any order.
+type writer struct {
+	w       io.Writer
+	n       int64
+	err     error
+	offsets []int64 // offsets[i] is where object i+1 starts
+}
+
+func newWriter(w io.Writer) *writer {
+	pw := &writer{w: w}
+	// the binary comment tells transfer programs the file isn't plain text
+	pw.printf("%%PDF-1.7\n%%\xe2\xe3\xcf\xd3\n")
+	return pw
+}
+
+func (w *writer) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *writer) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *writer) alloc() int {
+	w.offsets = append(w.offsets, -1)
+	return len(w.offsets)
+}
+
+// object writes object id with the dictionary or value body.
+func (w *writer) object(id int, body string) {
+	w.offsets[id-1] = w.n
+	w.printf("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+// stream writes object id as a stream with dict as its dictionary, minus
+// /Length, which is added. When compress is set the data is deflated.
+func (w *writer) stream(id int, dict string, data []byte, compress bool) {
+	if compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data = buf.Bytes()
+		dict += " /Filter /FlateDecode"
+	}
+
+	w.offsets[id-1] = w.n
+	w.printf("%d 0 obj\n<< %s /Length %d >>\nstream\n", id, dict, len(data))
+	w.write(data)
+	w.printf("\nendstream\nendobj\n")
+}
+
+// finish writes the xref table and the trailer.
+func (w *writer) finish(root int, info int) error {
+	start := w.n
+	w.printf("xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for i, offset := range w.offsets {
+		if offset < 0 && w.err == nil {
+			w.err = fmt.Errorf("pdf: o objeto %d nunca foi escrito", i+1)
+		}
+		w.printf("%010d 00000 n \n", offset)
+	}
+	w.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets)+1, root, info, start)
+	return w.err
+}
+
+func ref(id int) string {
+	return fmt.Sprintf("%d 0 R", id)
+}
+
+// textString encodes s as a PDF text string, in UTF-16 so any title works
+// in the outline and document info.
+func textString(s string) string {
+	var out strings.Builder
+	out.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&out, "%04X", u)
+	}
+	out.WriteString(">")
+	return out.String()
+}
+
+// literal escapes already encoded text for a (...) string in a content stream.
+func literal(s []byte) string {
+	var out strings.Builder
+	out.WriteByte('(')
+	for _, c := range s {
+		switch c {
+		case '(', ')', '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\n':
+			out.WriteString(`\n`)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte(')')
+	return out.String()
+}
+
+// num formats a coordinate without a pointless amount of decimals.
+func num(f float64) string {
+	s := fmt.Sprintf("%.2f", f)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// write numbers the objects of the laid out book and writes them to w.
+func (d *pdfDoc) write(w io.Writer, book *ebook.Book) error {
+	pw := newWriter(w)
+	size := d.cfg.PageSize
+
+	catalog, pagesID, resources, info := pw.alloc(), pw.alloc(), pw.alloc(), pw.alloc()
+	pageIDs := map[*page]int{}
+	for _, p := range d.pages {
+		pageIDs[p] = pw.alloc()
+	}
+	dest := func(p *page) string {
+		return fmt.Sprintf("[%s /Fit]", ref(pageIDs[p]))
+	}
+
+	// fonts and images, shared by every page
+	var fonts, xobjects strings.Builder
+	for f, name := range fontNames {
+		id := pw.alloc()
+		pw.object(id, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fmt.Fprintf(&fonts, " /%s %s", font(f).resource(), ref(id))
+	}
+	for _, img := range d.order {
+		img.id = pw.alloc()
+		pw.stream(img.id, img.dict, img.data, img.compress)
+		fmt.Fprintf(&xobjects, " /%s %s", img.resource, ref(img.id))
+	}
+	pw.object(resources, fmt.Sprintf("<< /ProcSet [/PDF /Text /ImageB /ImageC] /Font <<%s >> /XObject <<%s >> >>", fonts.String(), xobjects.String()))
+
+	var kids []string
+	for i, p := range d.pages {
+		content := p.content.Bytes()
+		if p.numbered {
+			number, _ := encode(fmt.Sprint(i + 1))
+			x := (size.Width - regular.width(number, footerSize)) / 2
+			content = fmt.Appendf(content, "BT /%s %s Tf %s %s Td %s Tj ET\n", regular.resource(), num(footerSize), num(x), num(d.cfg.Margin/2), literal(number))
+		}
+		contentID := pw.alloc()
+		pw.stream(contentID, "", content, true)
+
+		var annots []string
+		for _, l := range p.links {
+			action := ""
+			switch {
+			case l.uri != "":
+				action = fmt.Sprintf("/A << /S /URI /URI %s >>", literal([]byte(l.uri)))
+			case l.dest != nil:
+				action = "/Dest " + dest(l.dest)
+			case d.starts[l.href] != nil:
+				action = "/Dest " + dest(d.starts[l.href])
+			default:
+				continue
+			}
+			id := pw.alloc()
+			rect := fmt.Sprintf("[%s %s %s %s]", num(l.rect[0]), num(l.rect[1]), num(l.rect[2]), num(l.rect[3]))
+			pw.object(id, fmt.Sprintf("<< /Type /Annot /Subtype /Link /Rect %s /Border [0 0 0] %s >>", rect, action))
+			annots = append(annots, ref(id))
+		}
+
+		dict := fmt.Sprintf("<< /Type /Page /Parent %s /MediaBox [0 0 %s %s] /Resources %s /Contents %s", ref(pagesID), num(size.Width), num(size.Height), ref(resources), ref(contentID))
+		if len(annots) > 0 {
+			dict += " /Annots [" + strings.Join(annots, " ") + "]"
+		}
+		pw.object(pageIDs[p], dict+" >>")
+		kids = append(kids, ref(pageIDs[p]))
+	}
+	pw.object(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+
+	// the bookmarks repeat the table of contents, plus the contents themselves
+	outlines := pw.alloc()
+	entries := book.TOC()
+	if len(d.toc) > 0 {
+		entries = append([]ebook.Entry{{Title: d.labels.Contents, Href: "#contents"}}, entries...)
+		d.starts["#contents"] = d.toc[0]
+	}
+	first, last, count := d.outline(pw, outlines, entries, dest)
+	pw.object(outlines, fmt.Sprintf("<< /Type /Outlines /First %s /Last %s /Count %d >>", ref(first), ref(last), count))
+
+	pw.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %s /Outlines %s /PageMode /UseOutlines /Lang %s >>", ref(pagesID), ref(outlines), literal([]byte(book.Language()))))
+	pw.object(info, fmt.Sprintf("<< /Title %s /Author %s /Creator (wattpad-to-ebook) /Producer (wattpad-to-ebook) >>", textString(book.Metadata.Name), textString(book.Metadata.Author)))
+
+	return pw.finish(catalog, info)
+}
+
+// outline writes the bookmarks of entries under parent and returns the ids
+// of the first and last one and how many there are, counting nested ones.
+func (d *pdfDoc) outline(pw *writer, parent int, entries []ebook.Entry, dest func(*page) string) (int, int, int) {
+	ids := make([]int, len(entries))
+	for i := range entries {
+		ids[i] = pw.alloc()
+	}
+
+	total := len(entries)
+	for i, entry := range entries {
+		dict := fmt.Sprintf("<< /Title %s /Parent %s", textString(entry.Title), ref(parent))
+		if p := d.starts[entry.Href]; p != nil {
+			dict += " /Dest " + dest(p)
+		}
+		if i > 0 {
+			dict += " /Prev " + ref(ids[i-1])
+		}
+		if i < len(ids)-1 {
+			dict += " /Next " + ref(ids[i+1])
+		}
+		if len(entry.Children) > 0 {
+			first, last, count := d.outline(pw, ids[i], entry.Children, dest)
+			dict += fmt.Sprintf(" /First %s /Last %s /Count %d", ref(first), ref(last), count)
+			total += count
+		}
+		pw.object(ids[i], dict+" >>")
+	}
+
+	if len(ids) == 0 {
+		return 0, 0, 0
+	}
+	return ids[0], ids[len(ids)-1], total
+}
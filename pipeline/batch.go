@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"wattpad-to-ebook/library"
+	"wattpad-to-ebook/pool"
+	"wattpad-to-ebook/sources"
+)
+
+// ReadURLs reads one story url per line, ignoring blank lines and comments
+// starting with #, also at the end of a line.
+func ReadURLs(r io.Reader) ([]string, error) {
+	var urls []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			urls = append(urls, line)
+		}
+	}
+
+	return urls, scanner.Err()
+}
+
+// BatchResult is the outcome of one story of a batch.
+type BatchResult struct {
+	URL    string
+	Result Result
+	Err    error
+}
+
+// Batch downloads every story in urls, parallel of them at a time. urls of
+// reading lists or authors are replaced by the stories in them. A story that
+// fails doesn't stop the others: its error goes in its BatchResult, and the
+// results come back in the order of urls, the stories of a list where the
+// list was. opts.Output must be empty, since
+// each story gets its own file.
+func Batch(ctx context.Context, urls []string, lib *library.Library, opts Options, parallel int) []BatchResult {
+	results := expand(ctx, urls)
+
+	// os erros ficam em results, então o pool só para se ctx for cancelado
+	done := make([]bool, len(results))
+	pool.Run(ctx, parallel, len(results), func(ctx context.Context, i int) error {
+		done[i] = true
+		if results[i].Err != nil {
+			return nil
+		}
+
+		src, err := sources.For(results[i].URL)
+		if err != nil {
+			results[i].Err = err
+			return nil
+		}
+
+		results[i].Result, results[i].Err = Download(ctx, src, results[i].URL, lib, opts)
+		return nil
+	})
+
+	// the stories the cancelled pool never got to
+	for i := range results {
+		if !done[i] && results[i].Err == nil {
+			results[i].Err = ctx.Err()
+		}
+	}
+
+	return results
+}
+
+// expand turns urls into one BatchResult per story, listing the stories of
+// the urls that are lists. A list that can't be read is a failed result, and
+// a story that shows up twice is only kept the first time.
+func expand(ctx context.Context, urls []string) []BatchResult {
+	var results []BatchResult
+	seen := map[string]bool{}
+
+	add := func(url string) {
+		if !seen[url] {
+			seen[url] = true
+			results = append(results, BatchResult{URL: url})
+		}
+	}
+
+	for _, url := range urls {
+		lister, ok := sources.ListerFor(url)
+		if !ok {
+			add(url)
+			continue
+		}
+
+		list, err := lister.List(ctx, url)
+		if err != nil {
+			results = append(results, BatchResult{URL: url, Err: err})
+			continue
+		}
+		for _, story := range list.URLs {
+			add(story)
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"wattpad-to-ebook/docx"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/fb2"
+	"wattpad-to-ebook/pdf"
+	"wattpad-to-ebook/textfile"
+)
+
+// Format is the kind of file a book is written as.
+type Format string
+
+const (
+	// FormatEPUB is what the zero value means.
+	FormatEPUB Format = "epub"
+	// FormatKEPUB is an EPUB with the markup of Kobo readers.
+	FormatKEPUB Format = "kepub"
+	FormatPDF   Format = "pdf"
+	// FormatMarkdown and FormatText write the chapters as text, in a single
+	// file or, with Options.Split, a directory with a file per chapter.
+	FormatMarkdown Format = "md"
+	FormatText     Format = "txt"
+	// FormatHTML is a single page with the images inside it.
+	FormatHTML Format = "html"
+	// FormatFB2 is FictionBook 2, and FormatFB2Zip the same file zipped.
+	FormatFB2    Format = "fb2"
+	FormatFB2Zip Format = "fb2.zip"
+	// FormatDOCX is a Word document, to edit and comment on the story.
+	FormatDOCX Format = "docx"
+)
+
+// ParseFormat checks that s is one of the formats accepted by the CLI.
+func ParseFormat(s string) (Format, error) {
+	switch format := Format(s); format {
+	case FormatEPUB, FormatKEPUB, FormatPDF, FormatMarkdown, FormatText, FormatHTML, FormatFB2, FormatFB2Zip, FormatDOCX:
+		return format, nil
+	}
+	return "", fmt.Errorf("formato '%s' inválido, use epub, kepub, pdf, md, txt, html, fb2, fb2.zip ou docx", s)
+}
+
+// Extension is the file extension of the format, with the dot.
+func (f Format) Extension() string {
+	switch f {
+	case "":
+		return ".epub"
+	case FormatKEPUB:
+		// Kobo readers only apply their markup to files named like this
+		return ".kepub.epub"
+	}
+	return "." + string(f)
+}
+
+// text is the style of the text formats, and whether f is one.
+func (f Format) text() (textfile.Style, bool) {
+	switch f {
+	case FormatMarkdown:
+		return textfile.Markdown, true
+	case FormatText:
+		return textfile.Text, true
+	}
+	return 0, false
+}
+
+// output is where a book goes when opts.Output is empty: "<name> - <author>"
+// with the extension of the format, or without one for a directory of text
+// files, in the current directory.
+func output(name string, author string, opts Options) string {
+	if opts.Output != "" {
+		return opts.Output
+	}
+	if _, isText := opts.Format.text(); isText && opts.Split {
+		return fmt.Sprintf("%s - %s", name, author)
+	}
+	return fmt.Sprintf("%s - %s%s", name, author, opts.Format.Extension())
+}
+
+// write sends book, in the format of opts, to the file output, or to
+// standard output for "-".
+func write(book *ebook.Book, output string, opts Options) error {
+	if style, isText := opts.Format.text(); isText {
+		switch {
+		case opts.Split && output == "-":
+			return fmt.Errorf("um arquivo por capítulo não dá para mandar para o stdout")
+		case opts.Split:
+			return textfile.WriteDir(output, book, style)
+		case output == "-":
+			return textfile.Write(os.Stdout, book, style)
+		}
+		return textfile.WriteFile(output, book, style)
+	}
+
+	switch opts.Format {
+	case FormatPDF:
+		if output == "-" {
+			return pdf.Write(os.Stdout, book, opts.PDF)
+		}
+		return pdf.WriteFile(output, book, opts.PDF)
+	case FormatHTML:
+		if output == "-" {
+			return book.WriteHTML(os.Stdout)
+		}
+		return book.WriteHTMLFile(output)
+	case FormatFB2, FormatFB2Zip:
+		zipped := opts.Format == FormatFB2Zip
+		if output == "-" && zipped {
+			return fb2.WriteZip(os.Stdout, book, fmt.Sprintf("%s - %s.fb2", book.Metadata.Name, book.Metadata.Author))
+		}
+		if output == "-" {
+			return fb2.Write(os.Stdout, book)
+		}
+		return fb2.WriteFile(output, book, zipped)
+	case FormatDOCX:
+		if output == "-" {
+			return docx.Write(os.Stdout, book)
+		}
+		return docx.WriteFile(output, book)
+	case FormatKEPUB:
+		// a KEPUB is written like any EPUB once its markup is converted
+		if err := book.Kepub(); err != nil {
+			return err
+		}
+	}
+
+	if output == "-" {
+		_, err := book.WriteTo(os.Stdout)
+		return err
+	}
+	return book.WriteFile(output)
+}
@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/sources"
+)
+
+// Omnibus puts every story of list into a single book, in the order of the
+// list, and writes it to opts.Output ("<list name> - <author>" when empty) in
+// opts.Format. Each story is a section with its own title page and cover, and
+// its parts are nested under it in the table of contents. Unlike Batch it
+// fails as soon as one story fails, since the book would be incomplete.
+// Omnibus books aren't recorded in the library.
+func Omnibus(ctx context.Context, list sources.StoryList, opts Options) (Result, error) {
+	var result Result
+
+	stories, err := fetch_omnibus(ctx, list, opts, &result)
+
+	if err != nil {
+		return result, err
+	}
+
+	metadata := sources.Story_Metadata{
+		Source:      stories[0].metadata.Source,
+		ID:          list.ID,
+		Name:        list.Name,
+		Author:      list.Author,
+		Description: fmt.Sprintf("%d stories", len(stories)),
+		Language:    stories[0].metadata.Language,
+	}
+	if metadata.Author == "" {
+		metadata.Author = stories[0].metadata.Author
+	}
+	// the first story lends its cover to the whole book
+	metadata.CoverImage = stories[0].metadata.CoverImage
+	metadata.CoverImageType = stories[0].metadata.CoverImageType
+
+	epubName := output(metadata.Name, metadata.Author, opts)
+
+	book, err := build_omnibus(ctx, metadata, stories, opts)
+
+	if err != nil {
+		return result, err
+	}
+
+	if err := write(book, epubName, opts); err != nil {
+		return result, err
+	}
+	result.Output = epubName
+
+	return result, nil
+}
+
+// build_omnibus makes every story a section of the book, with its title
+// page and cover, and its parts nested under it.
+func build_omnibus(ctx context.Context, metadata sources.Story_Metadata, stories []fetched_story, opts Options) (*ebook.Book, error) {
+	book := ebook.NewBook(metadata)
+	// the images are named after a count of every part in the book, so parts
+	// with the same number in different stories don't collide
+	imageIndex := 0
+
+	for _, story := range stories {
+		section, err := book.AddSection(story.metadata.Name, story.metadata.Author, story.metadata.CoverImage, story.metadata.CoverImageType)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, chapter := range story.bookChapters {
+			imageIndex++
+			title := chapter.Title
+			if !opts.Selection.Empty() {
+				title = fmt.Sprintf("%d. %s", chapter.Index, chapter.Title)
+			}
+
+			if err := add_chapter(ctx, book, section, chapter.Index, imageIndex, title, story.bookTexts[i], opts); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return book, nil
+}
+
+// fetch_omnibus downloads the stories of list one after the other, applying
+// the paywall policy to each, and adds their paywalled parts to result. urls
+// of reading lists or authors in it, like in a batch file, are replaced by
+// the stories in them.
+func fetch_omnibus(ctx context.Context, list sources.StoryList, opts Options, result *Result) ([]fetched_story, error) {
+	var stories []fetched_story
+
+	for _, entry := range expand(ctx, list.URLs) {
+		if entry.Err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.URL, entry.Err)
+		}
+		url := entry.URL
+
+		src, err := sources.For(url)
+		if err != nil {
+			return nil, err
+		}
+
+		story, err := fetch_all(ctx, src, url, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", url, err)
+		}
+
+		result.Paywalled = append(result.Paywalled, story.paywalled...)
+		// with skip, a story can be left without any part
+		if len(story.bookChapters) > 0 {
+			stories = append(stories, story)
+		}
+	}
+
+	if len(stories) == 0 {
+		return nil, fmt.Errorf("nenhuma história de '%s' sobrou para o livro", list.Name)
+	}
+	return stories, nil
+}
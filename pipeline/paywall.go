@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"wattpad-to-ebook/sources"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// PaywallPolicy says what happens to parts that are behind a paywall.
+type PaywallPolicy string
+
+const (
+	// PaywallPlaceholder puts a page explaining the part is paywalled in its
+	// place. It is what the zero value means.
+	PaywallPlaceholder PaywallPolicy = "placeholder"
+	// PaywallSkip leaves paywalled parts out of the book.
+	PaywallSkip PaywallPolicy = "skip"
+	// PaywallAbort fails the download when any part is paywalled.
+	PaywallAbort PaywallPolicy = "abort"
+)
+
+// ParsePaywallPolicy checks that s is one of the policies accepted by the CLI.
+func ParsePaywallPolicy(s string) (PaywallPolicy, error) {
+	switch policy := PaywallPolicy(s); policy {
+	case PaywallPlaceholder, PaywallSkip, PaywallAbort:
+		return policy, nil
+	}
+	return "", fmt.Errorf("política de paywall '%s' inválida, use placeholder, skip ou abort", s)
+}
+
+// PaywalledError is returned with PaywallAbort and lists the locked parts.
+type PaywalledError struct {
+	Parts []sources.Story_Chapters
+}
+
+func (e *PaywalledError) Error() string {
+	names := make([]string, len(e.Parts))
+	for i, part := range e.Parts {
+		names[i] = fmt.Sprintf("%d. %s", part.Index, part.Title)
+	}
+	return fmt.Sprintf("a história tem partes pagas: %s", strings.Join(names, ", "))
+}
+
+// blank reports whether text has nothing a reader could see, which is what
+// the storytext API answers for parts that weren't bought.
+func blank(text []byte) bool {
+	if len(bytes.TrimSpace(text)) == 0 {
+		return true
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(text))
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(doc.Text()) == "" && doc.Find("img").Length() == 0
+}
+
+// mark_paywalled flags the fetched parts that came back blank as locked and
+// returns every locked part.
+func mark_paywalled(chapters []sources.Story_Chapters, texts [][]byte) []sources.Story_Chapters {
+	var locked []sources.Story_Chapters
+
+	for i := range chapters {
+		if !chapters[i].Locked && blank(texts[i]) {
+			chapters[i].Locked = true
+		}
+		if chapters[i].Locked {
+			locked = append(locked, chapters[i])
+		}
+	}
+
+	return locked
+}
+
+// locked_in returns the parts the listing already marked as locked.
+func locked_in(chapters []sources.Story_Chapters) []sources.Story_Chapters {
+	var locked []sources.Story_Chapters
+	for _, chapter := range chapters {
+		if chapter.Locked {
+			locked = append(locked, chapter)
+		}
+	}
+	return locked
+}
+
+// apply_paywall returns the chapters and texts that go in the book under policy.
+// Skipped parts keep the Index of the others, so the part numbers don't shift.
+func apply_paywall(chapters []sources.Story_Chapters, texts [][]byte, policy PaywallPolicy) ([]sources.Story_Chapters, [][]byte, error) {
+	var keptChapters []sources.Story_Chapters
+	var keptTexts [][]byte
+	var locked []sources.Story_Chapters
+
+	for i, chapter := range chapters {
+		if !chapter.Locked {
+			keptChapters = append(keptChapters, chapter)
+			keptTexts = append(keptTexts, texts[i])
+			continue
+		}
+
+		locked = append(locked, chapter)
+		if policy != PaywallSkip && policy != PaywallAbort {
+			keptChapters = append(keptChapters, chapter)
+			keptTexts = append(keptTexts, placeholder(chapter))
+		}
+	}
+
+	if policy == PaywallAbort && len(locked) > 0 {
+		return nil, nil, &PaywalledError{Parts: locked}
+	}
+
+	return keptChapters, keptTexts, nil
+}
+
+// placeholder is the page that stands in for a paywalled part.
+func placeholder(chapter sources.Story_Chapters) []byte {
+	var page strings.Builder
+	page.WriteString("<p><em>This part is paywalled and could not be downloaded.</em></p>\n")
+	if chapter.URL != "" {
+		fmt.Fprintf(&page, "<p>Read it on the original site: <a href=\"%s\">%s</a></p>\n", html.EscapeString(chapter.URL), html.EscapeString(chapter.URL))
+	}
+	return []byte(page.String())
+}
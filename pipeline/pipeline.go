@@ -0,0 +1,217 @@
+// Package pipeline turns a story from any registered source into an EPUB or another format.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"wattpad-to-ebook/ebook"
+	"wattpad-to-ebook/images"
+	"wattpad-to-ebook/library"
+	"wattpad-to-ebook/pdf"
+	"wattpad-to-ebook/pool"
+	"wattpad-to-ebook/sources"
+)
+
+// Options tunes how a story is downloaded.
+type Options struct {
+	// Concurrency is how many chapters, or images of a chapter, are
+	// downloaded at the same time. Values below 1 mean one at a time.
+	Concurrency int
+	// Recheck makes Update download known parts again to find edited ones.
+	Recheck bool
+	// Output is the file Download writes to. Empty means "<title> - <author>"
+	// with the extension of Format in the current directory, "-" means
+	// standard output.
+	Output string
+	// Format is the kind of file written. Empty means FormatEPUB.
+	Format Format
+	// Split writes FormatMarkdown and FormatText as a directory with a file
+	// per chapter instead of a single file.
+	Split bool
+	// PDF is the page setup of FormatPDF. The zero value means pdf.DefaultConfig.
+	PDF pdf.Config
+	// Paywalled is what to do with parts behind a paywall. Empty means
+	// PaywallPlaceholder.
+	Paywalled PaywallPolicy
+	// Selection limits the book to some of the parts, which then get their
+	// part number in the title.
+	Selection sources.Selection
+}
+
+// Result is what Download and Update report back.
+type Result struct {
+	// Output is where the book was written.
+	Output string
+	// Paywalled lists the parts that were locked, whatever the policy did with them.
+	Paywalled []sources.Story_Chapters
+	// Changes is only filled by Update.
+	Changes library.Changes
+}
+
+// Download fetches the story at url through src, writes the EPUB to
+// opts.Output and reports where it went. When lib isn't nil the story is
+// recorded there so it can be updated later.
+func Download(ctx context.Context, src sources.Source, url string, lib *library.Library, opts Options) (Result, error) {
+	var result Result
+
+	story, err := fetch_all(ctx, src, url, opts)
+
+	if err != nil {
+		return result, err
+	}
+	result.Paywalled = story.paywalled
+	metadata := story.metadata
+
+	epubName := output(metadata.Name, metadata.Author, opts)
+
+	book, err := build(ctx, metadata, story.bookChapters, story.bookTexts, opts)
+
+	if err != nil {
+		return result, err
+	}
+
+	if err := write(book, epubName, opts); err != nil {
+		return result, err
+	}
+	result.Output = epubName
+
+	// a book sent to stdout has nowhere to be updated later
+	if lib != nil && epubName != "-" {
+		if err := record(lib, src, url, metadata, story.chapters, story.texts, epubName, opts); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// fetched_story is a story with the text of its parts.
+type fetched_story struct {
+	metadata sources.Story_Metadata
+	// chapters and texts are every selected part, as the library records them.
+	chapters []sources.Story_Chapters
+	texts    [][]byte
+	// paywalled are the locked parts among chapters.
+	paywalled []sources.Story_Chapters
+	// bookChapters and bookTexts are what goes in the book once the paywall
+	// policy was applied.
+	bookChapters []sources.Story_Chapters
+	bookTexts    [][]byte
+}
+
+// fetch_all downloads the metadata and the selected parts of the story at
+// url, except the ones the listing already marks as locked.
+func fetch_all(ctx context.Context, src sources.Source, url string, opts Options) (fetched_story, error) {
+	var story fetched_story
+
+	metadata, chapters, err := fetch_story(ctx, src, url, opts.Selection)
+
+	if err != nil {
+		return story, err
+	}
+
+	// no point downloading anything when the listing already says it will fail
+	if locked := locked_in(chapters); opts.Paywalled == PaywallAbort && len(locked) > 0 {
+		return story, &PaywalledError{Parts: locked}
+	}
+
+	texts := make([][]byte, len(chapters))
+	var unlocked []int
+	for i := range chapters {
+		if !chapters[i].Locked {
+			unlocked = append(unlocked, i)
+		}
+	}
+
+	if err := fetch_texts(ctx, src, chapters, texts, unlocked, opts); err != nil {
+		return story, err
+	}
+
+	story = fetched_story{metadata: metadata, chapters: chapters, texts: texts}
+	story.paywalled = mark_paywalled(chapters, texts)
+	story.bookChapters, story.bookTexts, err = apply_paywall(chapters, texts, opts.Paywalled)
+
+	return story, err
+}
+
+// fetch_story reads the metadata and the parts selected by selection.
+func fetch_story(ctx context.Context, src sources.Source, url string, selection sources.Selection) (sources.Story_Metadata, []sources.Story_Chapters, error) {
+	metadata, chapters, err := src.Story(ctx, url)
+
+	if err != nil {
+		return sources.Story_Metadata{}, nil, err
+	}
+
+	if metadata.Source == "" {
+		metadata.Source = src.Name()
+	}
+
+	// the library tells parts apart by id, so sources without one fall back to the position
+	for i := range chapters {
+		if chapters[i].ID == "" {
+			chapters[i].ID = strconv.Itoa(chapters[i].Index)
+		}
+	}
+
+	chapters, err = selection.Apply(chapters)
+
+	if err != nil {
+		return sources.Story_Metadata{}, nil, err
+	}
+
+	return metadata, chapters, nil
+}
+
+// fetch_texts downloads the HTML of chapters[i] into texts[i] for every i in
+// which, opts.Concurrency at a time, stopping at the first error.
+func fetch_texts(ctx context.Context, src sources.Source, chapters []sources.Story_Chapters, texts [][]byte, which []int, opts Options) error {
+	return pool.Run(ctx, opts.Concurrency, len(which), func(ctx context.Context, j int) error {
+		i := which[j]
+		text, pages, err := src.ChapterHTML(ctx, chapters[i])
+		if err != nil {
+			return fmt.Errorf("%s: %w", chapters[i].Title, err)
+		}
+		texts[i] = text
+		chapters[i].Pages = pages
+		return nil
+	})
+}
+
+// build puts chapters, whose HTML is in texts, into an in-memory book,
+// downloading the images of each chapter on the way.
+func build(ctx context.Context, metadata sources.Story_Metadata, chapters []sources.Story_Chapters, texts [][]byte, opts Options) (*ebook.Book, error) {
+	book := ebook.NewBook(metadata)
+
+	for i, chapter := range chapters {
+		// with only some of the parts, the title tells which one this is
+		title := chapter.Title
+		if !opts.Selection.Empty() {
+			title = fmt.Sprintf("%d. %s", chapter.Index, chapter.Title)
+		}
+
+		if err := add_chapter(ctx, book, 0, chapter.Index, chapter.Index, title, texts[i], opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return book, nil
+}
+
+// add_chapter downloads the images of text and adds it to book as chapter
+// index of section. The images are named after imageIndex, which has to be
+// unique in the book.
+func add_chapter(ctx context.Context, book *ebook.Book, section int, index int, imageIndex int, title string, text []byte, opts Options) error {
+	modifiedBody, chapterImages, err := images.DownloadAndRewrite(ctx, text, imageIndex, opts.Concurrency)
+	if err != nil {
+		return err
+	}
+
+	for _, img := range chapterImages {
+		if err := book.AddImage(img); err != nil {
+			return err
+		}
+	}
+
+	return book.AddSectionChapter(section, index, title, modifiedBody)
+}
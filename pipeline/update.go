@@ -0,0 +1,166 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+	"wattpad-to-ebook/library"
+	"wattpad-to-ebook/pdf"
+	"wattpad-to-ebook/sources"
+)
+
+// Update compares the story recorded in lib with what src lists now, fetches
+// only the parts that are new (or every known part too, when opts.Recheck is
+// set, to find edits), and rebuilds the book at the recorded output path, in
+// the format and page setup it was downloaded with.
+// Parts that were paywalled are always fetched again, in case they were bought.
+// The parts selected when the story was downloaded are kept, unless
+// opts.Selection picks others.
+func Update(ctx context.Context, src sources.Source, lib *library.Library, story *library.Story, opts Options) (Result, error) {
+	result := Result{Output: story.OutputPath}
+
+	if opts.Selection.Empty() && story.Selection != nil {
+		opts.Selection = *story.Selection
+	}
+	// the book is rewritten in place, so it keeps its format and page setup
+	opts.Format = Format(story.Format)
+	opts.Split = story.Split
+	opts.PDF = pdf.Config{}
+	if story.PDF != nil {
+		opts.PDF = *story.PDF
+	}
+
+	metadata, chapters, err := fetch_story(ctx, src, story.URL, opts.Selection)
+
+	if err != nil {
+		return result, err
+	}
+
+	if locked := locked_in(chapters); opts.Paywalled == PaywallAbort && len(locked) > 0 {
+		return result, &PaywalledError{Parts: locked}
+	}
+
+	texts := make([][]byte, len(chapters))
+	seen := map[string]bool{}
+	var missing []int
+
+	for i, chapter := range chapters {
+		seen[chapter.ID] = true
+		old, known := story.ChapterByID(chapter.ID)
+
+		if chapter.Locked {
+			continue
+		}
+
+		if known && !opts.Recheck && !old.Locked && old.Title == chapter.Title {
+			text, err := lib.ChapterText(story.Key, chapter.ID)
+			if err == nil {
+				texts[i] = text
+				chapters[i].Pages = old.Pages
+				continue
+			}
+			// o cache sumiu, então baixa de novo e compara pelo hash
+		}
+		missing = append(missing, i)
+	}
+
+	if err := fetch_texts(ctx, src, chapters, texts, missing, opts); err != nil {
+		return result, err
+	}
+
+	result.Paywalled = mark_paywalled(chapters, texts)
+
+	for i, chapter := range chapters {
+		old, known := story.ChapterByID(chapter.ID)
+		fetched := library.NewChapter(chapter, texts[i])
+		switch {
+		case !known:
+			result.Changes.Added = append(result.Changes.Added, fetched)
+		case old.Hash != fetched.Hash || old.Title != fetched.Title || old.Locked != fetched.Locked:
+			result.Changes.Edited = append(result.Changes.Edited, fetched)
+		}
+	}
+
+	for _, old := range story.Chapters {
+		if !seen[old.ID] {
+			result.Changes.Removed = append(result.Changes.Removed, old)
+		}
+	}
+
+	bookChapters, bookTexts, err := apply_paywall(chapters, texts, opts.Paywalled)
+
+	if err != nil {
+		return result, err
+	}
+
+	if _, err := os.Stat(story.OutputPath); result.Changes.Empty() && err == nil {
+		story.LastFetched = time.Now().UTC()
+		return result, lib.Save()
+	}
+
+	book, err := build(ctx, metadata, bookChapters, bookTexts, opts)
+
+	if err != nil {
+		return result, err
+	}
+
+	if err := write(book, story.OutputPath, opts); err != nil {
+		return result, err
+	}
+
+	for _, old := range result.Changes.Removed {
+		if err := lib.RemoveChapterText(story.Key, old.ID); err != nil {
+			return result, err
+		}
+	}
+
+	return result, record(lib, src, story.URL, metadata, chapters, texts, story.OutputPath, opts)
+}
+
+// record stores the story and the HTML of its chapters in lib.
+func record(lib *library.Library, src sources.Source, url string, metadata sources.Story_Metadata, chapters []sources.Story_Chapters, texts [][]byte, output string, opts Options) error {
+	id := metadata.ID
+	if id == "" {
+		id = url
+	}
+
+	output, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+
+	story := &library.Story{
+		Key:         library.Key(src.Name(), id),
+		Source:      src.Name(),
+		ID:          id,
+		URL:         url,
+		Name:        metadata.Name,
+		Author:      metadata.Author,
+		LastFetched: time.Now().UTC(),
+		OutputPath:  output,
+	}
+
+	if opts.Format != FormatEPUB {
+		story.Format = string(opts.Format)
+	}
+	if _, isText := opts.Format.text(); isText {
+		story.Split = opts.Split
+	}
+	if config := opts.PDF; opts.Format == FormatPDF && config != (pdf.Config{}) {
+		story.PDF = &config
+	}
+	if selection := opts.Selection; !selection.Empty() {
+		story.Selection = &selection
+	}
+
+	for i, chapter := range chapters {
+		if err := lib.SaveChapterText(story.Key, chapter.ID, texts[i]); err != nil {
+			return err
+		}
+		story.Chapters = append(story.Chapters, library.NewChapter(chapter, texts[i]))
+	}
+
+	lib.Put(story)
+	return lib.Save()
+}
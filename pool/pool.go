@@ -0,0 +1,61 @@
+// Package pool runs indexed jobs on a bounded number of goroutines.
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Run calls fn once for every index in [0, n), with at most workers calls
+// running at the same time. Results should be stored by index, so the order
+// the calls finish in doesn't matter.
+//
+// After the first error no new calls are started, the ctx given to the
+// running ones is canceled, and that error is returned once they return.
+func Run(parent context.Context, workers int, n int, fn func(ctx context.Context, i int) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	jobs := make(chan int)
+
+	for range min(workers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := fn(ctx, i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for i := range n {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return parent.Err()
+}
@@ -0,0 +1,107 @@
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selection picks which parts of a story are converted, by their Index.
+// The zero value selects every part.
+type Selection struct {
+	// From and To bound the part numbers, both included. Zero leaves that
+	// side open.
+	From int `json:"from,omitempty"`
+	To   int `json:"to,omitempty"`
+	// Parts, when not empty, keeps only the parts inside one of the ranges.
+	Parts []Range `json:"parts,omitempty"`
+	// Latest keeps only the last Latest parts left by the other filters.
+	Latest int `json:"latest,omitempty"`
+}
+
+// Range is an inclusive range of part numbers, From == To for a single part.
+type Range struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// ParseRanges reads a list like "1,3,5-9".
+func ParseRanges(s string) ([]Range, error) {
+	var ranges []Range
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		first, last, isRange := strings.Cut(item, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil || from < 1 {
+			return nil, fmt.Errorf("'%s' não é um número de parte válido", item)
+		}
+		to := from
+		if isRange {
+			to, err = strconv.Atoi(strings.TrimSpace(last))
+			if err != nil || to < from {
+				return nil, fmt.Errorf("'%s' não é um intervalo de partes válido", item)
+			}
+		}
+
+		ranges = append(ranges, Range{From: from, To: to})
+	}
+
+	if len(ranges) == 0 {
+		return nil, errors.New("a lista de partes está vazia")
+	}
+	return ranges, nil
+}
+
+// Empty reports whether s selects every part.
+func (s Selection) Empty() bool {
+	return s.From == 0 && s.To == 0 && len(s.Parts) == 0 && s.Latest == 0
+}
+
+func (s Selection) contains(index int) bool {
+	if s.From > 0 && index < s.From {
+		return false
+	}
+	if s.To > 0 && index > s.To {
+		return false
+	}
+	if len(s.Parts) == 0 {
+		return true
+	}
+	for _, r := range s.Parts {
+		if index >= r.From && index <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the chapters s selects, in their original order and with
+// their original Index. It fails when nothing is left, since a book without
+// chapters can't be written.
+func (s Selection) Apply(chapters []Story_Chapters) ([]Story_Chapters, error) {
+	if s.Empty() {
+		return chapters, nil
+	}
+
+	var selected []Story_Chapters
+	for _, chapter := range chapters {
+		if s.contains(chapter.Index) {
+			selected = append(selected, chapter)
+		}
+	}
+
+	if s.Latest > 0 && len(selected) > s.Latest {
+		selected = selected[len(selected)-s.Latest:]
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("nenhuma das %d partes foi selecionada", len(chapters))
+	}
+	return selected, nil
+}
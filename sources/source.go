@@ -0,0 +1,140 @@
+// Package sources describes the sites stories can be downloaded from.
+//
+// Each site adapter implements Source and registers itself with Register, so
+// the ebook pipeline can pick the right one just by looking at the URL.
+package sources
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type Story_Metadata struct {
+	// Source is the Name of the source the story came from, like "wattpad".
+	Source string
+	// ID is the story identifier on its site, stable across title changes.
+	ID             string
+	Name           string
+	Author         string
+	Description    string
+	CoverImage     []byte
+	CoverImageType string
+	Tags           []string
+	// Language is the language name as the site reports it, like "English".
+	Language  string
+	Completed bool
+	Mature    bool
+	// URL is the page of the story on its site.
+	URL string
+	// Reads and Votes are the counts the site shows, 0 when it doesn't say.
+	Reads int
+	Votes int
+}
+
+type Story_Chapters struct {
+	// ID is the part identifier on its site, stable across title changes.
+	ID    string
+	Index int
+	Title string
+	URL   string
+	// Pages is how many pages the source split this part into, filled in
+	// when the chapter text is fetched.
+	Pages int
+	// Locked marks parts behind a paywall, either because the listing says
+	// so or because their text came back empty.
+	Locked bool
+}
+
+// Source is a site adapter that can feed the ebook builder.
+type Source interface {
+	// Name is a short identifier for the site, like "wattpad".
+	Name() string
+	// Match reports whether url points to a story this source understands.
+	Match(url string) bool
+	// Story fetches the title, author, description and cover of the story
+	// together with its parts, in reading order, so both describe the story
+	// at the same moment. It gives up as soon as ctx is cancelled.
+	Story(ctx context.Context, url string) (Story_Metadata, []Story_Chapters, error)
+	// ChapterHTML fetches the HTML body of a single part and how many pages
+	// it had, giving up as soon as ctx is cancelled.
+	ChapterHTML(ctx context.Context, chapter Story_Chapters) ([]byte, int, error)
+}
+
+// StoryList is a group of stories behind a single url, like a reading list
+// or everything published by an author.
+type StoryList struct {
+	// ID tells lists of the same source apart, e.g. "list-1234" or "user-name".
+	ID     string
+	Name   string
+	Author string
+	// URLs are the story urls, in the order the site lists them.
+	URLs []string
+}
+
+// Lister is implemented by sources that also understand urls of lists of stories.
+type Lister interface {
+	Source
+	// MatchList reports whether url points to a list this source understands.
+	MatchList(url string) bool
+	// List fetches every story url of the list, following its pages, and
+	// stops as soon as ctx is cancelled.
+	List(ctx context.Context, url string) (StoryList, error)
+}
+
+var (
+	mu       sync.RWMutex
+	registry []Source
+)
+
+// Register makes a source available to For. Adapters usually call it from init.
+func Register(src Source) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, s := range registry {
+		if s.Name() == src.Name() {
+			panic(fmt.Sprintf("sources: source %q registered twice", src.Name()))
+		}
+	}
+	registry = append(registry, src)
+}
+
+// For returns the first registered source that matches url.
+func For(url string) (Source, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, s := range registry {
+		if s.Match(url) {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("nenhuma fonte suporta a url '%s'", url)
+}
+
+// ListerFor returns the first registered source that knows url as a list of
+// stories, if any.
+func ListerFor(url string) (Lister, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, s := range registry {
+		if lister, ok := s.(Lister); ok && lister.MatchList(url) {
+			return lister, true
+		}
+	}
+	return nil, false
+}
+
+// Names lists the registered sources, in registration order.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for _, s := range registry {
+		names = append(names, s.Name())
+	}
+	return names
+}
@@ -0,0 +1,219 @@
+package textfile
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+	"wattpad-to-ebook/document"
+	"wattpad-to-ebook/ebook"
+)
+
+// lineWidth is where plain text is wrapped.
+const lineWidth = 72
+
+// writer writes blocks in a style, with a blank line between them.
+type writer struct {
+	*bufio.Writer
+	style Style
+	// images is the directory the images are in, relative to the text
+	images  string
+	started bool
+	// labels are the words the writer adds itself, like "by"
+	labels ebook.Labels
+}
+
+// imagePath is how the text refers to the image called name.
+func (w *writer) imagePath(name string) string {
+	return w.images + "/" + name
+}
+
+// block starts a new block, after a blank line unless it's the first.
+func (w *writer) block() {
+	if w.started {
+		w.WriteString("\n")
+	}
+	w.started = true
+}
+
+func (w *writer) heading(title string, level int) {
+	w.block()
+	if w.style == Markdown {
+		fmt.Fprintf(w, "%s %s\n", strings.Repeat("#", level), escape(title))
+		return
+	}
+
+	fmt.Fprintln(w, title)
+	switch level {
+	case 1:
+		fmt.Fprintln(w, strings.Repeat("=", utf8.RuneCountInString(title)))
+	case 2:
+		fmt.Fprintln(w, strings.Repeat("-", utf8.RuneCountInString(title)))
+	}
+}
+
+func (w *writer) paragraph(runs []document.Run, center bool) {
+	w.block()
+	if w.style == Markdown {
+		fmt.Fprintln(w, escapeStart(inline(runs)))
+		return
+	}
+
+	for _, line := range wrap(plain(runs), lineWidth) {
+		if center {
+			line = strings.Repeat(" ", max(lineWidth-utf8.RuneCountInString(line), 0)/2) + line
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func (w *writer) quote(runs []document.Run) {
+	w.block()
+	if w.style == Markdown {
+		text := escapeStart(inline(runs))
+		fmt.Fprintln(w, "> "+strings.ReplaceAll(text, "\n", "\n> "))
+		return
+	}
+
+	for _, line := range wrap(plain(runs), lineWidth-4) {
+		fmt.Fprintln(w, "    "+line)
+	}
+}
+
+func (w *writer) preformatted(text string) {
+	w.block()
+	if w.style == Markdown {
+		// a fence longer than any run of backticks in the text
+		fence := "```"
+		for strings.Contains(text, fence) {
+			fence += "`"
+		}
+		fmt.Fprintf(w, "%s\n%s\n%s\n", fence, text, fence)
+		return
+	}
+	fmt.Fprintln(w, text)
+}
+
+func (w *writer) image(src string, alt string) {
+	w.block()
+	if w.style == Markdown {
+		fmt.Fprintf(w, "![%s](%s)\n", escape(alt), linkTarget(src))
+		return
+	}
+	if alt != "" {
+		fmt.Fprintf(w, "[image: %s (%s)]\n", alt, src)
+		return
+	}
+	fmt.Fprintf(w, "[image: %s]\n", src)
+}
+
+// rule is a scene break.
+func (w *writer) rule() {
+	w.block()
+	if w.style == Markdown {
+		fmt.Fprintln(w, "* * *")
+		return
+	}
+	fmt.Fprintln(w, strings.Repeat(" ", (lineWidth-5)/2)+"* * *")
+}
+
+var markdownSpecial = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`,
+)
+
+// escape keeps Markdown from reading text as markup.
+func escape(text string) string {
+	return markdownSpecial.Replace(text)
+}
+
+// orderedList is a line that would turn into an ordered list item.
+var orderedList = regexp.MustCompile(`(?m)^(\d+)\. `)
+
+// escapeStart escapes what only means something at the start of a line: #
+// headings, - and + lists and numbered lists.
+func escapeStart(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" && strings.ContainsAny(line[:1], "#-+") {
+			lines[i] = `\` + line
+		}
+	}
+	return orderedList.ReplaceAllString(strings.Join(lines, "\n"), `$1\. `)
+}
+
+// inline is runs in Markdown. The spaces at the ends of a styled run go
+// outside the markers, which don't work with a space inside them.
+func inline(runs []document.Run) string {
+	var out strings.Builder
+	for _, run := range runs {
+		text := strings.TrimSpace(run.Text)
+		if text == "" {
+			out.WriteString(strings.ReplaceAll(run.Text, "\n", "\\\n"))
+			continue
+		}
+		start := strings.Index(run.Text, text)
+		lead, trail := run.Text[:start], run.Text[start+len(text):]
+
+		text = strings.ReplaceAll(escape(text), "\n", "\\\n")
+		marker := ""
+		switch {
+		case run.Bold && run.Italic:
+			marker = "***"
+		case run.Bold:
+			marker = "**"
+		case run.Italic:
+			marker = "*"
+		}
+		text = marker + text + marker
+		if run.Link != "" {
+			text = "[" + text + "](" + linkTarget(run.Link) + ")"
+		}
+
+		out.WriteString(strings.ReplaceAll(lead, "\n", "\\\n"))
+		out.WriteString(text)
+		out.WriteString(strings.ReplaceAll(trail, "\n", "\\\n"))
+	}
+	return out.String()
+}
+
+var linkEscapes = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29")
+
+func linkTarget(href string) string {
+	return linkEscapes.Replace(href)
+}
+
+// plain is runs as plain text, with the address of links after their text.
+func plain(runs []document.Run) string {
+	var out strings.Builder
+	for _, run := range runs {
+		out.WriteString(run.Text)
+		lower := strings.ToLower(run.Link)
+		if (strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")) && strings.TrimSpace(run.Text) != run.Link {
+			fmt.Fprintf(&out, " <%s>", run.Link)
+		}
+	}
+	return out.String()
+}
+
+// wrap breaks text into lines of at most width characters, at spaces, keeping
+// the line breaks already in it. Words longer than width get a line of their own.
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, hard := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(hard) {
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width:
+				lines = append(lines, line)
+				line = word
+			default:
+				line += " " + word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
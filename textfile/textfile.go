@@ -0,0 +1,266 @@
+// Package textfile writes a book as Markdown or wrapped plain text, easy to
+// keep in git and to grep: a single file with every chapter, or a directory
+// with a file per chapter. Images are written to a directory of their own
+// next to the text, which points at them.
+package textfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"wattpad-to-ebook/document"
+	"wattpad-to-ebook/ebook"
+)
+
+// Style is the markup of the text.
+type Style int
+
+const (
+	Markdown Style = iota
+	Text
+)
+
+// Extension is the file extension of the style, with the dot.
+func (s Style) Extension() string {
+	if s == Text {
+		return ".txt"
+	}
+	return ".md"
+}
+
+// Write writes every chapter of book to w, one after the other under a front
+// matter with the metadata of the story. Images aren't written, and are
+// referred to as images/<name>; see WriteFile.
+func Write(w io.Writer, book *ebook.Book, style Style) error {
+	return write(w, book, style, "images")
+}
+
+// write is Write with the images referred to in the directory images.
+func write(w io.Writer, book *ebook.Book, style Style, images string) error {
+	out := &writer{Writer: bufio.NewWriter(w), style: style, images: images, labels: book.Labels()}
+	out.frontMatter(book)
+	for _, entry := range book.TOC() {
+		if err := out.entry(entry, 1); err != nil {
+			return err
+		}
+		// in a single file the chapters of a section follow its title, a level down
+		for _, child := range entry.Children {
+			if err := out.entry(child, 2); err != nil {
+				return err
+			}
+		}
+	}
+	return out.Flush()
+}
+
+// WriteFile writes the book to the file name like Write does, and its images
+// to the directory <name without extension>_images next to it, so books
+// written to the same directory don't overwrite each other's images.
+func WriteFile(name string, book *ebook.Book, style Style) error {
+	images := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)) + "_images"
+	if err := writeImages(filepath.Join(filepath.Dir(name), images), book); err != nil {
+		return err
+	}
+	return ebook.CreateFile(name, func(w io.Writer) error {
+		return write(w, book, style, images)
+	})
+}
+
+// WriteDir writes the book to the directory dir, with an index holding the
+// front matter and a list of the chapters, a file per chapter named after
+// the page it is in the EPUB (chapter_3.md, story2_chapter_1.md) and the
+// images in dir/images.
+func WriteDir(dir string, book *ebook.Book, style Style) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := writeImages(filepath.Join(dir, "images"), book); err != nil {
+		return err
+	}
+
+	err := ebook.CreateFile(filepath.Join(dir, "index"+style.Extension()), func(w io.Writer) error {
+		out := &writer{Writer: bufio.NewWriter(w), style: style, images: "images", labels: book.Labels()}
+		out.frontMatter(book)
+		out.block()
+		var list func(entries []ebook.Entry, depth int)
+		list = func(entries []ebook.Entry, depth int) {
+			for _, entry := range entries {
+				name := fileName(entry.Href, style)
+				indent := strings.Repeat("  ", depth)
+				if style == Markdown {
+					fmt.Fprintf(out, "%s- [%s](%s)\n", indent, escape(entry.Title), name)
+				} else {
+					fmt.Fprintf(out, "%s%s (%s)\n", indent, entry.Title, name)
+				}
+				list(entry.Children, depth+1)
+			}
+		}
+		list(book.TOC(), 0)
+		return out.Flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	var write func(entries []ebook.Entry) error
+	write = func(entries []ebook.Entry) error {
+		for _, entry := range entries {
+			err := ebook.CreateFile(filepath.Join(dir, fileName(entry.Href, style)), func(w io.Writer) error {
+				out := &writer{Writer: bufio.NewWriter(w), style: style, images: "images", labels: book.Labels()}
+				if err := out.entry(entry, 1); err != nil {
+					return err
+				}
+				return out.Flush()
+			})
+			if err != nil {
+				return err
+			}
+			// the chapters of a section get their own files
+			if err := write(entry.Children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return write(book.TOC())
+}
+
+func fileName(href string, style Style) string {
+	return strings.TrimSuffix(href, filepath.Ext(href)) + style.Extension()
+}
+
+// writeImages puts the cover and the images of book in imageDir.
+func writeImages(imageDir string, book *ebook.Book) error {
+	cover, _ := book.Cover()
+	images := book.Images()
+	if cover == nil && len(images) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(imageDir, 0o755); err != nil {
+		return err
+	}
+	if cover != nil {
+		if err := os.WriteFile(filepath.Join(imageDir, book.CoverName()), cover, 0o644); err != nil {
+			return err
+		}
+	}
+	for _, img := range images {
+		if err := os.WriteFile(filepath.Join(imageDir, img.Name), img.Data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entry writes the title of a chapter or section at level, and the text of
+// the chapter with its headings below that level.
+func (w *writer) entry(entry ebook.Entry, level int) error {
+	w.heading(entry.Title, level)
+
+	if entry.Section != nil {
+		if entry.Section.Author != "" {
+			w.paragraph([]document.Run{{Text: w.labels.Byline(entry.Section.Author), Italic: true}}, false)
+		}
+		if entry.Section.Cover != "" {
+			w.image(w.imagePath(entry.Section.Cover), entry.Section.Title)
+		}
+		return nil
+	}
+
+	blocks, err := document.Parse(entry.Chapter.Body)
+	if err != nil {
+		return fmt.Errorf("capítulo '%s': %w", entry.Title, err)
+	}
+	for _, block := range blocks {
+		switch block.Kind {
+		case document.Heading:
+			w.heading(block.Text(), min(block.Level+level, 6))
+		case document.Quote:
+			w.quote(block.Runs)
+		case document.Preformatted:
+			w.preformatted(block.Text())
+		case document.Image:
+			w.image(w.imagePath(block.Image), block.Alt)
+		case document.Rule:
+			w.rule()
+		default:
+			w.paragraph(block.Runs, block.Align == document.AlignCenter)
+		}
+	}
+	return nil
+}
+
+// frontMatter is the metadata of the story, as YAML between --- lines for
+// Markdown and as "Key: value" lines for plain text.
+func (w *writer) frontMatter(book *ebook.Book) {
+	w.started = true
+	metadata := book.Metadata
+
+	status := "ongoing"
+	if metadata.Completed {
+		status = "completed"
+	}
+	fields := [][2]string{
+		{"title", metadata.Name},
+		{"author", metadata.Author},
+		{"source", metadata.Source},
+		{"id", metadata.ID},
+		{"language", metadata.Language},
+		{"status", status},
+	}
+	if metadata.Mature {
+		fields = append(fields, [2]string{"mature", "true"})
+	}
+	if cover, _ := book.Cover(); cover != nil {
+		fields = append(fields, [2]string{"cover", w.imagePath(book.CoverName())})
+	}
+
+	if w.style == Text {
+		for _, field := range fields {
+			if field[1] != "" {
+				fmt.Fprintf(w, "%s: %s\n", strings.ToUpper(field[0][:1])+field[0][1:], field[1])
+			}
+		}
+		if len(metadata.Tags) > 0 {
+			fmt.Fprintf(w, "Tags: %s\n", strings.Join(metadata.Tags, ", "))
+		}
+		if metadata.Description != "" {
+			w.WriteString("\n")
+			for _, line := range wrap(metadata.Description, lineWidth) {
+				fmt.Fprintln(w, line)
+			}
+		}
+		fmt.Fprintln(w, "\n"+strings.Repeat("=", lineWidth))
+		return
+	}
+
+	w.WriteString("---\n")
+	for _, field := range fields {
+		switch {
+		case field[1] == "":
+		case field[0] == "mature":
+			fmt.Fprintf(w, "%s: %s\n", field[0], field[1])
+		default:
+			fmt.Fprintf(w, "%s: %s\n", field[0], strconv.Quote(field[1]))
+		}
+	}
+	if len(metadata.Tags) > 0 {
+		tags := make([]string, len(metadata.Tags))
+		for i, tag := range metadata.Tags {
+			tags[i] = strconv.Quote(tag)
+		}
+		fmt.Fprintf(w, "tags: [%s]\n", strings.Join(tags, ", "))
+	}
+	if description := strings.TrimSpace(metadata.Description); description != "" {
+		w.WriteString("description: |\n")
+		for _, line := range strings.Split(description, "\n") {
+			fmt.Fprintf(w, "  %s\n", strings.TrimRight(line, " \r"))
+		}
+	}
+	w.WriteString("---\n")
+}
@@ -0,0 +1,132 @@
+package wattpadstories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"wattpad-to-ebook/sources"
+)
+
+// listPageSize is how many stories are asked per page of a list. The API
+// answers with a nextUrl while there are more.
+const listPageSize = 50
+
+// maxListPages caps the pages followed for a single list, in case nextUrl
+// never goes away.
+const maxListPages = 200
+
+// api_Story_Page is one page of the stories of a reading list or author.
+type api_Story_Page struct {
+	Stories []struct {
+		ID    json.Number `json:"id"`
+		Title string      `json:"title"`
+		URL   string      `json:"url"`
+	} `json:"stories"`
+	NextURL string `json:"nextUrl"`
+}
+
+// list_ID takes the numeric id out of a reading list url like
+// https://www.wattpad.com/list/1234567890-favorites
+func list_ID(list_url string) string {
+	return path_Segment(list_url, "/list/", "-")
+}
+
+// user_Name takes the username out of a profile url like
+// https://www.wattpad.com/user/quietwriter
+func user_Name(user_url string) string {
+	return path_Segment(user_url, "/user/", "")
+}
+
+// path_Segment returns the path segment after prefix, cut at sep when it isn't empty.
+func path_Segment(raw string, prefix string, sep string) string {
+	_, after, found := strings.Cut(raw, prefix)
+	if !found {
+		return ""
+	}
+	after, _, _ = strings.Cut(after, "/")
+	after, _, _ = strings.Cut(after, "?")
+	if sep != "" {
+		after, _, _ = strings.Cut(after, sep)
+	}
+	return after
+}
+
+func (Wattpad) MatchList(list_url string) bool {
+	if !strings.Contains(list_url, "www.wattpad.com/") && !strings.HasPrefix(list_url, BaseURL+"/") {
+		return false
+	}
+	return list_ID(list_url) != "" || user_Name(list_url) != ""
+}
+
+// List reads the stories of a reading list (/list/<id>) or the stories
+// published by an author (/user/<name>).
+func (Wattpad) List(ctx context.Context, list_url string) (sources.StoryList, error) {
+	fields := url.QueryEscape("stories(id,title,url),nextUrl")
+
+	if id := list_ID(list_url); id != "" {
+		var info struct {
+			Name string `json:"name"`
+			User struct {
+				Name string `json:"name"`
+			} `json:"user"`
+		}
+		if err := get_JSON(ctx, fmt.Sprintf("%s/api/v3/lists/%s?fields=%s", BaseURL, id, url.QueryEscape("name,user(name)")), &info); err != nil {
+			return sources.StoryList{}, fmt.Errorf("lista %s: %w", id, err)
+		}
+
+		list := sources.StoryList{ID: "list-" + id, Name: info.Name, Author: info.User.Name}
+		first := fmt.Sprintf("%s/api/v3/lists/%s/stories?offset=0&limit=%d&fields=%s", BaseURL, id, listPageSize, fields)
+		return list, get_List_Pages(ctx, first, &list)
+	}
+
+	if name := user_Name(list_url); name != "" {
+		list := sources.StoryList{ID: "user-" + name, Name: "Stories by " + name, Author: name}
+		first := fmt.Sprintf("%s/api/v3/users/%s/stories/published?offset=0&limit=%d&fields=%s", BaseURL, url.PathEscape(name), listPageSize, fields)
+		return list, get_List_Pages(ctx, first, &list)
+	}
+
+	return sources.StoryList{}, fmt.Errorf("'%s' não é uma lista de leitura nem um perfil", list_url)
+}
+
+// get_List_Pages follows the nextUrl of every page from first, adding the
+// story urls to list.
+func get_List_Pages(ctx context.Context, first string, list *sources.StoryList) error {
+	seenPages := map[string]bool{}
+	seenStories := map[string]bool{}
+
+	for next := first; next != "" && !seenPages[next]; {
+		if len(seenPages) >= maxListPages {
+			return fmt.Errorf("a lista passou de %d páginas", maxListPages)
+		}
+		seenPages[next] = true
+
+		var page api_Story_Page
+		if err := get_JSON(ctx, next, &page); err != nil {
+			return fmt.Errorf("página %d da lista: %w", len(seenPages), err)
+		}
+
+		for _, story := range page.Stories {
+			story_url := story.URL
+			if story_url == "" && story.ID != "" {
+				story_url = fmt.Sprintf("%s/story/%s", BaseURL, story.ID)
+			}
+			if story_url != "" && !seenStories[story_url] {
+				seenStories[story_url] = true
+				list.URLs = append(list.URLs, story_url)
+			}
+		}
+
+		next = page.NextURL
+		if strings.HasPrefix(next, "/") {
+			next = BaseURL + next
+		}
+	}
+
+	if len(list.URLs) == 0 {
+		return errors.New("a lista não tem nenhuma história")
+	}
+	return nil
+}
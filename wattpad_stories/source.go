@@ -0,0 +1,34 @@
+package wattpadstories
+
+import (
+	"context"
+	"strings"
+	"wattpad-to-ebook/sources"
+)
+
+// Wattpad is the sources.Source for www.wattpad.com stories.
+type Wattpad struct{}
+
+func init() {
+	sources.Register(Wattpad{})
+}
+
+func (Wattpad) Name() string {
+	return "wattpad"
+}
+
+func (Wattpad) Match(url string) bool {
+	return strings.Contains(url, "www.wattpad.com/story") || strings.HasPrefix(url, BaseURL+"/story/")
+}
+
+// Story reads the metadata and the parts with a single call to the story
+// API, or to the story page when the API fails.
+func (Wattpad) Story(ctx context.Context, url string) (Story_Metadata, []Story_Chapters, error) {
+	chapters, metadata, err := Get_Chapters(ctx, url)
+
+	return metadata, chapters, err
+}
+
+func (Wattpad) ChapterHTML(ctx context.Context, chapter Story_Chapters) ([]byte, int, error) {
+	return Get_Chapter_Text(ctx, chapter.URL)
+}
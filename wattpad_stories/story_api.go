@@ -0,0 +1,132 @@
+package wattpadstories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"wattpad-to-ebook/fetch"
+)
+
+// storyAPIFields are the fields asked from the v3 story endpoint. Without a
+// fields parameter the API leaves most of them out.
+const storyAPIFields = "id,title,user(name),description,cover,parts(id,title,url,isBlocked),tags,language(id,name),completed,mature,url,readCount,voteCount"
+
+// api_Story is the part of the v3 story JSON we use.
+// The API sends ids as strings or numbers depending on the field, json.Number takes both.
+type api_Story struct {
+	ID    json.Number `json:"id"`
+	Title string      `json:"title"`
+	User  struct {
+		Name string `json:"name"`
+	} `json:"user"`
+	Description string   `json:"description"`
+	Cover       string   `json:"cover"`
+	Tags        []string `json:"tags"`
+	Language    struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"language"`
+	Completed bool   `json:"completed"`
+	Mature    bool   `json:"mature"`
+	URL       string `json:"url"`
+	ReadCount int    `json:"readCount"`
+	VoteCount int    `json:"voteCount"`
+	Parts     []struct {
+		ID    json.Number `json:"id"`
+		Title string      `json:"title"`
+		URL   string      `json:"url"`
+		// IsBlocked is set on parts that need to be bought
+		IsBlocked bool `json:"isBlocked"`
+	} `json:"parts"`
+}
+
+func story_API_URL(story_url string) (string, error) {
+	id := story_ID(story_url)
+	if id == "" {
+		return "", fmt.Errorf("não achei o id da história em '%s'", story_url)
+	}
+	return fmt.Sprintf("%s/api/v3/stories/%s?fields=%s", BaseURL, id, url.QueryEscape(storyAPIFields)), nil
+}
+
+func get_Story_JSON(ctx context.Context, story_url string) (api_Story, error) {
+	var story api_Story
+
+	api_url, err := story_API_URL(story_url)
+
+	if err != nil {
+		return story, err
+	}
+
+	if err := get_JSON(ctx, api_url, &story); err != nil {
+		return story, fmt.Errorf("json da história: %w", err)
+	}
+
+	if story.Title == "" || len(story.Parts) == 0 {
+		return story, errors.New("a api não devolveu o título ou as partes da história")
+	}
+
+	return story, nil
+}
+
+// get_JSON requests api_url and decodes the JSON answer into v.
+func get_JSON(ctx context.Context, api_url string, v any) error {
+	req, err := new_Request(ctx, api_url)
+
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http_Client().Do(req)
+
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return &fetch.StatusError{URL: api_url, StatusCode: resp.StatusCode}
+	}
+
+	body, err := getReader(resp)
+
+	if err != nil {
+		return err
+	}
+
+	return json.NewDecoder(body).Decode(v)
+}
+
+func (s api_Story) metadata() Story_Metadata {
+	return Story_Metadata{
+		Source:      Wattpad{}.Name(),
+		ID:          s.ID.String(),
+		Name:        s.Title,
+		Author:      s.User.Name,
+		Description: s.Description,
+		Tags:        s.Tags,
+		Language:    s.Language.Name,
+		Completed:   s.Completed,
+		Mature:      s.Mature,
+		URL:         s.URL,
+		Reads:       s.ReadCount,
+		Votes:       s.VoteCount,
+	}
+}
+
+func (s api_Story) chapters() []Story_Chapters {
+	chapter_list := make([]Story_Chapters, 0, len(s.Parts))
+
+	for i, part := range s.Parts {
+		id := part.ID.String()
+		if id == "" {
+			id = part_ID(part.URL)
+		}
+
+		chapter_list = append(chapter_list, Story_Chapters{ID: id, Index: i + 1, Title: part.Title, URL: part.URL, Locked: part.IsBlocked})
+	}
+
+	return chapter_list
+}
@@ -2,35 +2,52 @@ package wattpadstories
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"compress/flate"
 	"compress/gzip"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
+	"wattpad-to-ebook/fetch"
+	"wattpad-to-ebook/sources"
+
 	"github.com/PuerkitoBio/goquery"
 	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/zstd"
-	"github.com/gabriel-vasile/mimetype"
 )
 
 
-type Story_Metadata struct {
-	Name string
-	Author string
-	Description string
-	CoverImage []byte
-	CoverImageType string
+// The story types live in the sources package so every site adapter shares them.
+type Story_Metadata = sources.Story_Metadata
+
+type Story_Chapters = sources.Story_Chapters
+
+// BaseURL is where story pages and the Wattpad APIs are requested from.
+// Tests point it at a local fake server.
+var BaseURL = "https://www.wattpad.com"
+
+var client *fetch.Client
+
+// SetClient makes every wattpadstories request go through c instead of
+// http_Client(). Passing nil goes back to the default.
+func SetClient(c *fetch.Client) {
+	client = c
 }
 
-type Story_Chapters struct {
-	Index int
-	Title string
-	URL string
+func http_Client() *fetch.Client {
+	if client != nil {
+		return client
+	}
+	return fetch.Default()
 }
 
+// maxChapterPages caps the storytext pages requested for a single part, in case
+// the API never answers with an empty page.
+const maxChapterPages = 100
+
 
 
 func getReader(resp *http.Response) (io.ReadCloser, error) {
@@ -55,13 +72,18 @@ func getReader(resp *http.Response) (io.ReadCloser, error) {
   }
 }
 
-func get_Image(img_url string) ([]byte, string, error) {
+func get_Image(ctx context.Context, img_url string) ([]byte, string, error) {
 
-	resp, err := http.Get(img_url)
+	resp, err := http_Client().Get(ctx, img_url)
 
 	if err != nil {
 		return nil, "", err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, "", &fetch.StatusError{URL: img_url, StatusCode: resp.StatusCode}
+	}
 
 	body, err := io.ReadAll(resp.Body)
 
@@ -69,63 +91,149 @@ func get_Image(img_url string) ([]byte, string, error) {
 		return nil, "", err
 	}
 
-	return body, resp.Header.Get("content-type"),nil
+	return body, resp.Header.Get("content-type"), nil
 }
 
-func Get_Chapters(story_url string, ) ([]Story_Chapters, Story_Metadata, error) {
-	client := &http.Client{}
-
-	req, err := http.NewRequest("GET", story_url, nil)
+func Get_Chapters(ctx context.Context, story_url string) ([]Story_Chapters, Story_Metadata, error) {
+	story_metadata, chapter_list, cover_img_url, err := get_Story(ctx, story_url)
 
 	if err != nil {
 		return nil, Story_Metadata{}, err
 	}
 
+	// a story without a cover, or whose cover can't be downloaded, is still
+	// made into a book, only without the cover
+	if cover_img_url != "" {
+		story_metadata.CoverImage, story_metadata.CoverImageType, err = get_Image(ctx, cover_img_url)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, Story_Metadata{}, ctx.Err()
+			}
+			log.Printf("cover unavailable, '%s' will have none: %v", story_metadata.Name, err)
+			story_metadata.CoverImage, story_metadata.CoverImageType = nil, ""
+		}
+	}
+
+	return chapter_list, story_metadata, nil
+}
+
+// get_Story reads the metadata and part list from the JSON story API, and only
+// scrapes the story page when the API fails. The cover is returned as a url so
+// callers that don't need it can skip the download.
+func get_Story(ctx context.Context, story_url string) (Story_Metadata, []Story_Chapters, string, error) {
+	story, jsonErr := get_Story_JSON(ctx, story_url)
+
+	if jsonErr == nil {
+		story_metadata := story.metadata()
+		if story_metadata.ID == "" {
+			story_metadata.ID = story_ID(story_url)
+		}
+		if story_metadata.URL == "" {
+			story_metadata.URL = story_url
+		}
+		return story_metadata, story.chapters(), story.Cover, nil
+	}
+
+	doc, htmlErr := get_Story_Page(ctx, story_url)
+
+	if htmlErr == nil {
+		story_metadata, cover_img_url := parse_Metadata(doc)
+		chapter_list := parse_Chapters(doc)
+
+		if story_metadata.Name != "" && len(chapter_list) > 0 {
+			story_metadata.Source = Wattpad{}.Name()
+			story_metadata.ID = story_ID(story_url)
+			story_metadata.URL = story_url
+			return story_metadata, chapter_list, cover_img_url, nil
+		}
+		htmlErr = errors.New("a página não tem título ou partes, os seletores devem ter mudado")
+	}
+
+	return Story_Metadata{}, nil, "", fmt.Errorf("não deu para ler a história %s: api json: %w; página html: %w", story_url, jsonErr, htmlErr)
+}
+
+// story_ID takes the numeric id out of a story url like
+// https://www.wattpad.com/story/389173089-managers-duties
+func story_ID(story_url string) string {
+	_, after, found := strings.Cut(story_url, "/story/")
+	if !found {
+		return ""
+	}
+	return strings.Split(after, "-")[0]
+}
+
+// part_ID takes the numeric id out of a part url like
+// https://www.wattpad.com/1512345678-managers-duties-chapter-1
+func part_ID(chapter_url string) string {
+	chapter_url = strings.TrimSuffix(chapter_url, "/")
+	last := chapter_url[strings.LastIndex(chapter_url, "/")+1:]
+	return strings.Split(last, "-")[0]
+}
+
+// new_Request builds a GET with the headers Wattpad expects from a browser,
+// cancelled along with ctx.
+func new_Request(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
 	req.Header.Set("user-agent", "Mozilla/5.0 (X11; Linux x86_64; rv:139.0) Gecko/20100101 Firefox/139.0")
 	req.Header.Set("Accept-Encoding", "gzip, deflate, br, zstd")
+	return req, nil
+}
 
-	resp, err := client.Do(req)
+func get_Story_Page(ctx context.Context, story_url string) (*goquery.Document, error) {
+	req, err := new_Request(ctx, story_url)
 
 	if err != nil {
-	return nil, Story_Metadata{}, err
+		return nil, err
 	}
 
-	
+	resp, err := http_Client().Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
 	if resp.StatusCode != 200 {
-		return nil, Story_Metadata{}, fmt.Errorf("deu algum problema aqui: o código é %d", resp.StatusCode)
+		return nil, fmt.Errorf("deu algum problema aqui: o código é %d", resp.StatusCode)
 	}
 	
 	body, err := getReader(resp)
 	
 	if err != nil {
-		return nil, Story_Metadata{}, err
-	}
-	
-	doc, err := goquery.NewDocumentFromReader(body)
-	if err != nil {
-		return nil, Story_Metadata{}, err
+		return nil, err
 	}
 	
-	// chap_html := `div[data-testid="toc"] ul[aria-label="story-parts"]`
-	var story_metadata Story_Metadata
+	return goquery.NewDocumentFromReader(body)
+}
 
-	var chapter_list []Story_Chapters
+func parse_Metadata(doc *goquery.Document) (Story_Metadata, string) {
+	var story_metadata Story_Metadata
 
 	title := doc.Find(`div.gF-N5`).Text()
 	author := doc.Find(`div[data-testid="story-badges"] a`).Text()
 	description := doc.Find("pre.mpshL._6pPkw").Text()
-	cover_img_url, _ := doc.Find("img.cover__BlyZa").Attr("src")
-	cover_img_bytes, imgtype, err := get_Image(cover_img_url)
-	
-	if err != nil {
-		return []Story_Chapters{}, Story_Metadata{}, err
+	// stories without a cover have no img, and the url stays empty
+	cover_img_url := ""
+	if src, ok := doc.Find("img.cover__BlyZa").Attr("src"); ok {
+		cover_img_url = strings.TrimSpace(src)
 	}
 
 	story_metadata.Name = title
 	story_metadata.Author = author
 	story_metadata.Description = description
-	story_metadata.CoverImage = cover_img_bytes
-	story_metadata.CoverImageType = imgtype
+
+	return story_metadata, cover_img_url
+}
+
+func parse_Chapters(doc *goquery.Document) []Story_Chapters {
+	// chap_html := `div[data-testid="toc"] ul[aria-label="story-parts"]`
+	var chapter_list []Story_Chapters
 
 	chapter_finder := doc.Find(`div[data-testid="toc"] ul[aria-label="story-parts"]`)
 
@@ -133,97 +241,84 @@ func Get_Chapters(story_url string, ) ([]Story_Chapters, Story_Metadata, error)
     href, exists := s.Attr("href")
     if exists {
 		chapter_list = append(chapter_list,
-    Story_Chapters{Index: i+1, Title: s.Find("div.wpYp-").Text(), URL: href},
+    Story_Chapters{ID: part_ID(href), Index: i+1, Title: s.Find("div.wpYp-").Text(), URL: href, Locked: is_Locked(s)},
 	)	
     }
 	
 	})
 
-	return chapter_list, story_metadata, nil
+	return chapter_list
 }
 
+// is_Locked looks for the lock icon Wattpad puts next to paid parts in the table of contents.
+func is_Locked(s *goquery.Selection) bool {
+	return s.Find(`[data-testid*="lock"], [aria-label*="lock"], [aria-label*="Lock"], svg[class*="lock"]`).Length() > 0
+}
 
 
-func Get_Chapter_Text(chapter_url string) ([]byte, error) {
 
-	client := &http.Client{}
+// Get_Chapter_Text downloads every page of a part from the storytext API and
+// returns them concatenated, together with the number of pages found.
+// Wattpad splits long parts into pages, so it keeps asking for the next page
+// until the API answers with empty content. Cancelling ctx stops the
+// download, retries included.
+func Get_Chapter_Text(ctx context.Context, chapter_url string) ([]byte, int, error) {
 
-	id := strings.Split(chapter_url[24:], "-")[0]
-	
-	
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://www.wattpad.com/apiv2/?m=storytext&id=%s&page=0", id), nil)
+	id := part_ID(chapter_url)
 
-	if err != nil {
-		return nil, err
-	}
+	var text bytes.Buffer
+	var previous []byte
+	pages := 0
 
-	resp, err := client.Do(req)
+	for page := 0; page < maxChapterPages; page++ {
+		pageBytes, err := get_Chapter_Page(ctx, id, page)
 
-	if err != nil {
-		return nil, err
+		if err != nil {
+			// a página 0 sempre existe; depois dela um 4xx só quer dizer que as páginas acabaram
+			var status *fetch.StatusError
+			if page > 0 && errors.As(err, &status) && status.StatusCode < 500 {
+				break
+			}
+			return nil, 0, err
+		}
+
+		pageBytes = bytes.TrimSpace(pageBytes)
+		if len(pageBytes) == 0 || bytes.Equal(pageBytes, previous) {
+			break
+		}
+
+		text.Write(pageBytes)
+		text.WriteString("\n")
+		previous = pageBytes
+		pages++
 	}
 
-	body, err := getReader(resp)
-	
+	return text.Bytes(), pages, nil
+}
+
+func get_Chapter_Page(ctx context.Context, id string, page int) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/apiv2/?m=storytext&id=%s&page=%d", BaseURL, id, page), nil)
+
 	if err != nil {
 		return nil, err
 	}
 
-	bodyBytes, err := io.ReadAll(body)
-	
+	resp, err := http_Client().Do(req)
+
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	return bodyBytes, nil
-}
+	if resp.StatusCode != 200 {
+		return nil, &fetch.StatusError{URL: req.URL.String(), StatusCode: resp.StatusCode}
+	}
 
-func DownloadAndRewriteImages(htmlContent []byte, tempDir string, chapIndex int) (string, bool,error) {
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(htmlContent))
+	body, err := getReader(resp)
+	
 	if err != nil {
-		return "", false, err
+		return nil, err
 	}
 
-	foundAnyImage := false
-
-	doc.Find("img").Each(func(i int, s *goquery.Selection) {
-    src, exists := s.Attr("src")
-    if !exists || strings.TrimSpace(src) == "" {
-        return
-    }
-
-    // Download da imagem
-    res, err := http.Get(src)
-    if err != nil {
-        return
-    }
-    defer res.Body.Close()
-
-    // Detectar tipo e salvar imagem
-    buf, err := io.ReadAll(res.Body)
-    if err != nil {
-        return
-    }
-
-    contentType := mimetype.Detect(buf)
-
-    filename := fmt.Sprintf("chapter%d_img%d%s", chapIndex, i, contentType.Extension())
-    path := filepath.Join(tempDir, "images", filename)
-
-    os.MkdirAll(filepath.Join(tempDir, "images"), os.ModePerm)
-    os.WriteFile(path, buf, 0644)
-
-    s.SetAttr("src", fmt.Sprintf("../images/%s", filename))
-    s.SetAttr("width", "100%")
-
-    foundAnyImage = true
-})
-
-htmlBody, err := doc.Html()
-
-if err != nil {
-	return "", false, nil
+	return io.ReadAll(body)
 }
-
-return htmlBody, foundAnyImage, nil
-}
\ No newline at end of file